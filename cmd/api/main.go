@@ -1,28 +1,113 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"go-template/config"
+	"go-template/database/migrations"
+	"go-template/routes"
 )
 
 func main() {
+	configFile := flag.String("config", "", "optional YAML/JSON config file, overrides CONFIG_FILE")
+	printConfig := flag.Bool("print-config", false, "print the resolved config with secrets masked and exit")
+	flag.Parse()
+
+	if *printConfig {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+		cfg.Print(os.Stdout)
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "config problems:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// structured logs, also picks up the standard log package output
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	// log.Fatal only after run returned, so its deferred closes have run
+	if err := run(*configFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until a signal or a server failure and returns after shutdown,
+// a failed start or a failed server is an error so the process exits non-zero
+func run(configFile string) error {
 	// Initialize config
-	cfg, err := config.InitConfig()
+	cfg, err := config.InitConfig(configFile)
 	if err != nil {
-		log.Fatalf("failed to initialize config: %v", err)
+		return fmt.Errorf("failed to initialize config: %w", err)
 	}
-	defer cfg.DB.Close()
+	defer cfg.Close()
 
 	log.Println("Config initialized successfully")
 
+	if cfg.Database.MigrateOnBoot {
+		if err := migrations.MigrateOnBoot(context.Background(), cfg.DB, cfg.Database.MigrateChecksumMode == "fail"); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	// cancelled on shutdown to stop background work started by the router
+	appCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+	var background sync.WaitGroup
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.HTTP.Port),
+		Handler:           routes.NewRouter(appCtx, cfg, &background),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP server listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	<-quit
+	var failure error
+	select {
+	case <-quit:
+	case err := <-serverErr:
+		failure = fmt.Errorf("HTTP server failed: %w", err)
+	}
 	log.Println("Shutting down gracefully...")
+
+	// drain in-flight requests before the deferred cfg.Close runs
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown incomplete: %v", err)
+	}
+
+	// the outbox worker may be mid send, a mail SMTP accepted has to be
+	// marked sent before the deferred cfg.Close closes the pool, and a
+	// password reset email may still be queueing
+	stopApp()
+	background.Wait()
+	return failure
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"go-template/config"
+	"go-template/utils"
+)
+
+// template path, the files are read again on every request so edits show
+// on reload, check templates/email
+var templatePath = "templates/email"
+
+func main() {
+	addr := flag.String("addr", "localhost:8025", "address the preview server listens on")
+	dir := flag.String("dir", templatePath, "path to the email templates and their *.fixtures.json files")
+	catcher := flag.String("catcher", "localhost:1025", "SMTP address of a local catcher such as MailHog or Mailpit, used by send")
+	configFile := flag.String("config", "", "optional YAML/JSON config file, overrides CONFIG_FILE")
+	flag.Parse()
+
+	// only the app and sender settings are used, the rest may be unset
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	// fixtures and the unauthenticated send endpoint are for development only
+	if cfg.App.Env == "production" {
+		log.Fatalf("refusing to run the mail preview with APP_ENV=production")
+	}
+
+	from := &mail.Address{Name: cfg.SMTP.FromName, Address: cfg.SMTP.FromEmail}
+	if from.Address == "" {
+		from.Address = "preview@localhost"
+	}
+
+	catcherMailer, err := newCatcherMailer(*catcher)
+	if err != nil {
+		log.Fatalf("invalid -catcher: %v", err)
+	}
+
+	preview := &previewServer{dir: *dir, defaultLocale: cfg.Mail.DefaultLocale, from: from, catcher: catcherMailer}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           preview.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	log.Printf("Mail preview of %s on http://%s, sending to %s", *dir, *addr, *catcher)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newCatcherMailer talks plain SMTP without auth, catchers accept anything
+func newCatcherMailer(address string) (*utils.SMTPMailer, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewSMTPMailer(utils.SMTPMailerConfig{
+		Host:     host,
+		Port:     port,
+		Security: utils.SMTPSecurityNone,
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go-template/utils"
+)
+
+// fixtureSuffix names the fixtures of verify.*.html verify.fixtures.json, an
+// object of named data shared by every locale:
+//
+//	{
+//	    "default":   {"Name": "Jane Doe", "VerifyURL": "http://...", "ExpiredTime": "24 hours"},
+//	    "long_name": {"Name": "Maximiliane Alexandra ...", ...}
+//	}
+const fixtureSuffix = ".fixtures.json"
+
+type previewServer struct {
+	dir           string
+	defaultLocale string
+	from          *mail.Address
+	catcher       utils.Mailer
+}
+
+type templateFixtures struct {
+	Name     string
+	Locales  []string
+	Fixtures []string
+}
+
+func (preview *previewServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", preview.index)
+	mux.HandleFunc("GET /{template}/{locale}/{fixture}/html", preview.html)
+	mux.HandleFunc("GET /{template}/{locale}/{fixture}/text", preview.text)
+	mux.HandleFunc("GET /{template}/{locale}/{fixture}/raw", preview.raw)
+	mux.HandleFunc("POST /{template}/{locale}/{fixture}/send", preview.send)
+	return mux
+}
+
+func (preview *previewServer) index(write http.ResponseWriter, request *http.Request) {
+	templates, err := utils.LoadEmailTemplates(os.DirFS(preview.dir), preview.defaultLocale)
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var list []templateFixtures
+	for _, name := range templates.Names() {
+		fixtures, err := preview.fixtures(name)
+		if err != nil {
+			http.Error(write, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		names := make([]string, 0, len(fixtures))
+		for fixture := range fixtures {
+			names = append(names, fixture)
+		}
+		sort.Strings(names)
+		list = append(list, templateFixtures{Name: name, Locales: templates.Locales(), Fixtures: names})
+	}
+
+	write.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexPage.Execute(write, list); err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (preview *previewServer) html(write http.ResponseWriter, request *http.Request) {
+	message, ok := preview.render(write, request)
+	if !ok {
+		return
+	}
+	write.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(write, message.HTML)
+}
+
+func (preview *previewServer) text(write http.ResponseWriter, request *http.Request) {
+	message, ok := preview.render(write, request)
+	if !ok {
+		return
+	}
+	if message.Text == "" {
+		http.Error(write, "no plain text alternative, add "+request.PathValue("template")+"."+request.PathValue("locale")+".txt", http.StatusNotFound)
+		return
+	}
+	write.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(write, message.Text)
+}
+
+func (preview *previewServer) raw(write http.ResponseWriter, request *http.Request) {
+	message, ok := preview.render(write, request)
+	if !ok {
+		return
+	}
+
+	data, err := message.Bytes()
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	write.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	write.Write(data)
+}
+
+// send takes ?to=, the catcher accepts any address
+func (preview *previewServer) send(write http.ResponseWriter, request *http.Request) {
+	message, ok := preview.render(write, request)
+	if !ok {
+		return
+	}
+	if to := request.FormValue("to"); to != "" {
+		if _, err := mail.ParseAddress(to); err != nil {
+			http.Error(write, fmt.Sprintf("invalid ?to=%q: %v", to, err), http.StatusBadRequest)
+			return
+		}
+		message.To = []string{to}
+	}
+
+	recipients, err := message.Recipients()
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := message.Bytes()
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	envelope := utils.Mail{From: message.From.Address, Recipients: recipients, Data: data}
+	if err := preview.catcher.Send(request.Context(), envelope); err != nil {
+		http.Error(write, "failed to send to the catcher: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	fmt.Fprintf(write, "Sent %s/%s/%s to %s\n", request.PathValue("template"), request.PathValue("locale"), request.PathValue("fixture"), message.To[0])
+}
+
+// render reloads the templates and renders one fixture, writing the error
+// page itself when that fails
+func (preview *previewServer) render(write http.ResponseWriter, request *http.Request) (*utils.Message, bool) {
+	name := request.PathValue("template")
+	locale := request.PathValue("locale")
+	fixtureName := request.PathValue("fixture")
+
+	templates, err := utils.LoadEmailTemplates(os.DirFS(preview.dir), preview.defaultLocale)
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	// an unsupported locale would silently render the default one
+	if _, ok := templates.MatchLocale(locale); !ok {
+		http.Error(write, fmt.Sprintf("locale %q has no catalog in locales/", locale), http.StatusNotFound)
+		return nil, false
+	}
+
+	fixtures, err := preview.fixtures(name)
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	data, ok := fixtures[fixtureName]
+	if !ok {
+		http.Error(write, fmt.Sprintf("fixture %q not found in %s%s", fixtureName, name, fixtureSuffix), http.StatusNotFound)
+		return nil, false
+	}
+
+	rendered, err := templates.Render(name, locale, data)
+	if err != nil {
+		http.Error(write, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &utils.Message{
+		From:    preview.from,
+		To:      []string{"preview@example.com"},
+		Subject: fmt.Sprintf("[preview %s/%s] %s", rendered.Locale, fixtureName, rendered.Subject),
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	}, true
+}
+
+// fixtures returns only "default", with empty data, when the template has no
+// fixture file yet
+func (preview *previewServer) fixtures(name string) (map[string]map[string]any, error) {
+	content, err := os.ReadFile(filepath.Join(preview.dir, name+fixtureSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]map[string]any{"default": {}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures map[string]map[string]any
+	if err := json.Unmarshal(content, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid %s%s: %w", name, fixtureSuffix, err)
+	}
+	return fixtures, nil
+}
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Email preview</title>
+    <style>
+        body { font-family: sans-serif; margin: 2rem; }
+        td { padding: 0.25rem 1rem 0.25rem 0; }
+        form { display: inline; }
+    </style>
+</head>
+<body>
+    <h1>Email templates</h1>
+    <table>
+    {{range .}}
+        {{$template := .Name}}
+        {{$fixtures := .Fixtures}}
+        {{range $locale := .Locales}}
+        {{range $fixtures}}
+        <tr>
+            <td><b>{{$template}}</b></td>
+            <td>{{$locale}}</td>
+            <td>{{.}}</td>
+            <td><a href="/{{$template}}/{{$locale}}/{{.}}/html">HTML</a></td>
+            <td><a href="/{{$template}}/{{$locale}}/{{.}}/text">Text</a></td>
+            <td><a href="/{{$template}}/{{$locale}}/{{.}}/raw">Raw MIME</a></td>
+            <td>
+                <form method="post" action="/{{$template}}/{{$locale}}/{{.}}/send">
+                    <input name="to" value="preview@example.com">
+                    <button>Send to catcher</button>
+                </form>
+            </td>
+        </tr>
+        {{end}}
+        {{end}}
+    {{end}}
+    </table>
+</body>
+</html>
+`))
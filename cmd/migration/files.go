@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"go-template/database/migrations"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// createMigration writes the next NNNN_name.up.sql and .down.sql pair
+func createMigration(dir, name string) ([]string, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("name must be snake_case, e.g. add_users, got %q", name)
+	}
+
+	files, err := migrations.List(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	version := uint(1)
+	if len(files) > 0 {
+		version = files[len(files)-1].Version + 1
+	}
+
+	var created []string
+	for _, direction := range []source.Direction{source.Up, source.Down} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+
+		// O_EXCL so an existing file is never overwritten
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return created, fmt.Errorf("failed to create migration: %w", err)
+		}
+		_, err = fmt.Fprintf(file, "-- %04d_%s %s\n", version, name, direction)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return created, fmt.Errorf("failed to write migration: %w", err)
+		}
+		created = append(created, path)
+	}
+	return created, nil
+}
@@ -1,43 +1,143 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"text/tabwriter"
 
 	"go-template/config"
+	"go-template/database/migrations"
+	"go-template/database/seeds"
+	"go-template/db"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// migration path, check database/migrations
+// migration path for create, check database/migrations. Other actions use
+// the files embedded in the binary unless -path is set.
 var migrationPath = "database/migrations"
 
+// seed path, one directory per environment, check database/seeds
+var seedPath = "database/seeds"
+
 func main() {
-	action := flag.String("action", "up", "migration action: up, down, drop, version")
-	steps := flag.Int("steps", 0, "number of steps to migrate (only for up/down)")
-	path := flag.String("path", migrationPath, "path to migration files")
+	action := flag.String("action", "up", "migration action: up, down, drop, version, create, status, force, goto, redo, seed")
+	steps := flag.Int("steps", 0, "number of steps to migrate (only for up/down/redo)")
+	path := flag.String("path", "", "path to migration files, the embedded files when empty")
+	name := flag.String("name", "", "migration name in snake_case (only for create)")
+	version := flag.Int("version", 0, "target version (only for force/goto), force accepts -1 to clear every version")
+	env := flag.String("env", "dev", "seed environment: dev, test, demo (only for seed)")
+	seedsDir := flag.String("seeds-path", seedPath, "path to seed directories (only for seed)")
+	dryRun := flag.Bool("dry-run", false, "print the SQL up, down, goto or redo would run without running it")
+	yes := flag.Bool("yes", false, "skip the confirmation of drop and a full down, refused anyway with APP_ENV=production")
+	configFile := flag.String("config", "", "optional YAML/JSON config file, overrides CONFIG_FILE")
 	flag.Parse()
 
-	cfg, err := config.InitConfig()
+	// create only touches files, no database needed
+	if *action == "create" {
+		dir := *path
+		if dir == "" {
+			dir = migrationPath
+		}
+		created, err := createMigration(dir, *name)
+		for _, file := range created {
+			log.Printf("Created %s", file)
+		}
+		if err != nil {
+			log.Fatalf("create failed: %v", err)
+		}
+		return
+	}
+
+	versionSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "version" {
+			versionSet = true
+		}
+	})
+
+	// only the database section is needed to migrate
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	database, err := cfg.Database.Connect()
 	if err != nil {
-		log.Fatalf("failed to init config: %v", err)
+		log.Fatalf("failed to connect database: %v", err)
 	}
+	defer database.Close()
 
-	dbURL := cfg.DB.Config().ConnString()
+	if *action == "seed" {
+		// seeds hold known passwords
+		if cfg.App.Env == "production" {
+			log.Fatalf("refusing to seed with APP_ENV=production")
+		}
 
-	// migrate expects: file://<path>
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", *path),
-		dbURL,
-	)
+		applied, err := seeds.Run(context.Background(), db.New(database, db.Options{}), *seedsDir, *env)
+		if err != nil {
+			log.Fatalf("seed failed: %v", err)
+		}
+		for _, name := range applied {
+			log.Printf("Seeded %s/%s", *env, name)
+		}
+		log.Printf("Seed success: %d applied", len(applied))
+		return
+	}
+
+	source := migrations.Source(*path)
+	m, err := migrations.New(source, database.Config().ConnString())
 	if err != nil {
-		log.Fatalf("failed to init migrate: %v", err)
+		log.Fatal(err)
 	}
 	defer m.Close()
 
+	switch *action {
+	case "force":
+		if !versionSet {
+			log.Fatalf("force requires -version, e.g. -version=3")
+		}
+	case "goto":
+		if !versionSet || *version <= 0 {
+			log.Fatalf("goto requires a positive -version, e.g. -version=3")
+		}
+	}
+
+	if *dryRun {
+		if err := printDryRun(m, source, *action, *steps, uint(max(*version, 0))); err != nil {
+			log.Fatalf("dry run failed: %v", err)
+		}
+		return
+	}
+
+	// drop and a full down remove every table, a typo in DB_* must not cost data
+	if *action == "drop" || (*action == "down" && *steps <= 0) {
+		if cfg.App.Env == "production" {
+			log.Fatalf("refusing to %s with APP_ENV=production", *action)
+		}
+		if !*yes && !confirm(os.Stdin, os.Stderr, *action, database.Config().ConnConfig.Database) {
+			log.Fatalf("%s cancelled", *action)
+		}
+	}
+
+	ctx := context.Background()
+	switch *action {
+	case "up", "down", "goto", "redo", "status":
+		strict := cfg.Database.MigrateChecksumMode == "fail"
+		if err := migrations.VerifyChecksums(ctx, database, source, strict); err != nil {
+			log.Fatalf("checksum check failed: %v", err)
+		}
+	}
+
 	switch *action {
 	case "up":
 		if *steps > 0 {
@@ -55,10 +155,27 @@ func main() {
 		err = m.Drop()
 	case "version":
 		version, dirty, verr := m.Version()
+		if errors.Is(verr, migrate.ErrNilVersion) {
+			log.Println("No migration applied yet")
+			return
+		}
 		if verr != nil {
 			log.Fatalf("failed to get version: %v", verr)
 		}
 		log.Printf("Current version: %d, Dirty: %v\n", version, dirty)
+	case "status":
+		err = printStatus(m, source)
+	case "force":
+		// force only rewrites the version row, fix the schema by hand first
+		err = m.Force(*version)
+	case "goto":
+		err = m.Migrate(uint(*version))
+	case "redo":
+		// roll back and re-apply the last steps, 1 by default
+		n := max(*steps, 1)
+		if err = m.Steps(-n); err == nil {
+			err = m.Steps(n)
+		}
 	default:
 		log.Fatalf("unknown action: %s", *action)
 	}
@@ -66,5 +183,95 @@ func main() {
 	if err != nil && err != migrate.ErrNoChange {
 		log.Fatalf("migration failed: %v", err)
 	}
+
+	switch *action {
+	case "up", "down", "goto", "redo", "force":
+		if err := recordChecksums(ctx, m, database, source); err != nil {
+			log.Fatalf("failed to record checksums: %v", err)
+		}
+	}
 	log.Println("Migration success:", *action)
 }
+
+// recordChecksums syncs the checksum table with the version migrate ended on
+func recordChecksums(ctx context.Context, m *migrate.Migrate, database *pgxpool.Pool, source fs.FS) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return migrations.RecordChecksums(ctx, database, source, 0, false)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+	if dirty {
+		return nil
+	}
+	return migrations.RecordChecksums(ctx, database, source, version, true)
+}
+
+// printDryRun prints the SQL action would run without touching the database
+func printDryRun(m *migrate.Migrate, source fs.FS, action string, steps int, target uint) error {
+	if action == "drop" {
+		fmt.Println("-- drop removes every table, view and type in the database, including schema_migrations")
+		return nil
+	}
+
+	files, err := migrations.List(source)
+	if err != nil {
+		return err
+	}
+
+	current, dirty, err := m.Version()
+	applied := true
+	if errors.Is(err, migrate.ErrNilVersion) {
+		applied = false
+	} else if err != nil {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("version %d is dirty, nothing would run", current)
+	}
+
+	planned, err := plan(files, current, applied, action, steps, target)
+	if err != nil {
+		return err
+	}
+	return printPlan(os.Stdout, source, planned)
+}
+
+// printStatus marks every migration file as applied or pending. golang-migrate
+// only stores the current version, everything up to it counts as applied.
+func printStatus(m *migrate.Migrate, source fs.FS) error {
+	files, err := migrations.List(source)
+	if err != nil {
+		return err
+	}
+
+	current, dirty, err := m.Version()
+	applied := true
+	if errors.Is(err, migrate.ErrNilVersion) {
+		applied = false
+	} else if err != nil {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS")
+	for _, migration := range files {
+		status := "pending"
+		switch {
+		case applied && migration.Version == current && dirty:
+			status = "dirty"
+		case applied && migration.Version <= current:
+			status = "applied"
+		}
+		fmt.Fprintf(writer, "%04d\t%s\t%s\n", migration.Version, migration.Name, status)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if dirty {
+		log.Printf("Version %d is dirty, fix the schema and run -action=force -version=N", current)
+	}
+	return nil
+}
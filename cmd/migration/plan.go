@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"go-template/database/migrations"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+type planStep struct {
+	file      migrations.File
+	direction source.Direction
+}
+
+// plan lists the files an action would run, in order. applied is false when
+// no migration ran yet.
+func plan(files []migrations.File, current uint, applied bool, action string, steps int, target uint) ([]planStep, error) {
+	position := -1
+	if applied {
+		position = slices.IndexFunc(files, func(file migrations.File) bool { return file.Version == current })
+		if position < 0 {
+			return nil, fmt.Errorf("current version %d has no migration file", current)
+		}
+	}
+
+	up := func(from, to int) []planStep {
+		var result []planStep
+		for _, file := range files[from:to] {
+			result = append(result, planStep{file: file, direction: source.Up})
+		}
+		return result
+	}
+	down := func(from, to int) []planStep {
+		var result []planStep
+		for i := to - 1; i >= from; i-- {
+			result = append(result, planStep{file: files[i], direction: source.Down})
+		}
+		return result
+	}
+	limit := func(result []planStep, n int) []planStep {
+		if n > 0 && n < len(result) {
+			return result[:n]
+		}
+		return result
+	}
+
+	switch action {
+	case "up":
+		return limit(up(position+1, len(files)), steps), nil
+	case "down":
+		return limit(down(0, position+1), steps), nil
+	case "goto":
+		index := slices.IndexFunc(files, func(file migrations.File) bool { return file.Version == target })
+		if index < 0 {
+			return nil, fmt.Errorf("version %d has no migration file", target)
+		}
+		if index > position {
+			return up(position+1, index+1), nil
+		}
+		return down(index+1, position+1), nil
+	case "redo":
+		n := min(max(steps, 1), position+1)
+		return append(down(position+1-n, position+1), up(position+1-n, position+1)...), nil
+	default:
+		return nil, fmt.Errorf("-dry-run does not support %s", action)
+	}
+}
+
+// printPlan writes every file that would run with its SQL
+func printPlan(writer io.Writer, fsys fs.FS, steps []planStep) error {
+	if len(steps) == 0 {
+		fmt.Fprintln(writer, "-- nothing to run")
+		return nil
+	}
+
+	for _, step := range steps {
+		name := step.file.UpFile
+		if step.direction == source.Down {
+			name = step.file.DownFile
+		}
+		if name == "" {
+			return fmt.Errorf("version %d has no %s file", step.file.Version, step.direction)
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fmt.Fprintf(writer, "-- %s\n%s\n\n", name, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+// confirm asks for the database name before a destructive action
+func confirm(reader io.Reader, writer io.Writer, action, database string) bool {
+	fmt.Fprintf(writer, "%s removes data from database %q. Type the database name to continue: ", action, database)
+
+	answer, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	return strings.TrimSpace(answer) == database
+}
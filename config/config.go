@@ -1,23 +1,464 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go-template/templates"
 	"go-template/utils"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Config is read from, in order of precedence: environment variables, the
+// .env file and the optional YAML/JSON file in CONFIG_FILE. Every field is
+// named by its env tag, the file may use the same flat names or nest them,
+// e.g. "db: {host: localhost}" for DB_HOST.
 type Config struct {
+	App      AppConfig
+	HTTP     HTTPConfig
+	Database DatabaseConfig
+	JWT      JWTConfig
+	Auth     AuthConfig
+	Mail     MailConfig
+	SMTP     SMTPConfig
+	DKIM     DKIMConfig
+	S3       S3Config
+	Jobs     JobsConfig
+
+	// DB is the primary pool opened by InitConfig
 	DB *pgxpool.Pool
+	// Replicas are read-only pools, one per DB_REPLICA_URLS entry
+	Replicas []*pgxpool.Pool
+}
+
+type AppConfig struct {
+	// Env is development, staging or production, development relaxes secret checks
+	Env string `env:"APP_ENV" default:"production"`
+	URL string `env:"APP_URL" default:"http://localhost:8080"`
+}
+
+type HTTPConfig struct {
+	Port              int           `env:"APP_PORT" default:"8080"`
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT_SECONDS" default:"10" unit:"1s"`
+	RequestTimeout    time.Duration `env:"HTTP_REQUEST_TIMEOUT_SECONDS" default:"30" unit:"1s"`
+	ShutdownTimeout   time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT_SECONDS" default:"15" unit:"1s"`
+}
+
+// DatabaseConfig takes DATABASE_URL or the discrete DB_* fields
+type DatabaseConfig struct {
+	URL      string `env:"DATABASE_URL" secret:"true"`
+	User     string `env:"DB_USER"`
+	Password string `env:"DB_PASSWORD" secret:"true"`
+	Host     string `env:"DB_HOST"`
+	Port     string `env:"DB_PORT" default:"5432"`
+	Name     string `env:"DB_NAME"`
+	SSLMode  string `env:"DB_SSL_MODE" default:"disable"`
+
+	// zero keeps the pgxpool default
+	MaxConns          int           `env:"DB_MAX_CONNS" default:"0"`
+	MinConns          int           `env:"DB_MIN_CONNS" default:"0"`
+	MaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME_SECONDS" default:"0" unit:"1s"`
+	MaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME_MINUTES" default:"0" unit:"1m"`
+	HealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD_SECONDS" default:"0" unit:"1s"`
+	StatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT_MS" default:"0" unit:"1ms"`
+	ConnectTimeout    time.Duration `env:"DB_CONNECT_TIMEOUT_SECONDS" default:"30" unit:"1s"`
+
+	// SlowQueryThreshold of 0 disables the slow query log, LogQueryArgs adds
+	// sanitized arguments to it
+	SlowQueryThreshold time.Duration `env:"DB_SLOW_QUERY_MS" default:"200" unit:"1ms"`
+	LogQueryArgs       bool          `env:"DB_LOG_QUERY_ARGS" default:"false"`
+
+	// MigrateOnBoot makes cmd/api apply the embedded migrations at startup
+	MigrateOnBoot bool `env:"MIGRATE_ON_BOOT" default:"false"`
+	// MigrateChecksumMode is warn or fail, for applied migrations edited afterwards
+	MigrateChecksumMode string `env:"MIGRATE_CHECKSUM_MODE" default:"warn"`
+
+	// TxMaxAttempts bounds db.WithTx retries after serialization failures
+	TxMaxAttempts int `env:"DB_TX_MAX_ATTEMPTS" default:"3"`
+
+	// ReplicaURLs share the pool settings above, reads fall back to the
+	// primary while every replica is unhealthy
+	ReplicaURLs                []string      `env:"DB_REPLICA_URLS" secret:"true"`
+	ReplicaHealthCheckInterval time.Duration `env:"DB_REPLICA_HEALTH_CHECK_SECONDS" default:"10" unit:"1s"`
+}
+
+type JWTConfig struct {
+	Algorithm      string        `env:"JWT_ALGORITHM" default:"HS256"`
+	PrivateKeyPath string        `env:"JWT_PRIVATE_KEY_PATH"`
+	KeyID          string        `env:"JWT_KEY_ID"`
+	VerifyKeyPaths []string      `env:"JWT_VERIFY_KEY_PATHS"`
+	AccessSecret   string        `env:"JWT_ACCESS_SECRET" secret:"true"`
+	RefreshSecret  string        `env:"JWT_REFRESH_SECRET" secret:"true"`
+	AccessTTL      time.Duration `env:"JWT_ACCESS_TTL_MINUTES" default:"15" unit:"1m"`
+	RefreshTTL     time.Duration `env:"JWT_REFRESH_TTL_DAYS" default:"7" unit:"24h"`
+	Issuer         string        `env:"JWT_ISSUER"`
+	Audience       []string      `env:"JWT_AUDIENCE"`
 }
 
-func InitConfig() (*Config, error) {
+type AuthConfig struct {
+	VerifyTokenTTL time.Duration `env:"AUTH_VERIFY_TOKEN_TTL_HOURS" default:"24" unit:"1h"`
+	// ResetPasswordURL defaults to APP_URL/reset-password
+	ResetPasswordURL string        `env:"AUTH_RESET_PASSWORD_URL"`
+	ResetTokenTTL    time.Duration `env:"AUTH_RESET_TOKEN_TTL_MINUTES" default:"60" unit:"1m"`
+	RBACCacheTTL     time.Duration `env:"RBAC_CACHE_TTL_SECONDS" default:"300" unit:"1s"`
+}
+
+type MailConfig struct {
+	// Transport is smtp, file (writes .eml files to Dir), memory or log
+	Transport string `env:"MAIL_TRANSPORT" default:"smtp"`
+	Dir       string `env:"MAIL_DIR" default:"tmp/mail"`
+	// TemplatesDir reads the email templates from disk instead of the ones
+	// embedded in the binary, e.g. templates/email while editing them
+	TemplatesDir string `env:"MAIL_TEMPLATES_DIR"`
+	// DefaultLocale is used when neither the user nor Accept-Language names a
+	// locale with a catalog in templates/email/locales
+	DefaultLocale string `env:"MAIL_DEFAULT_LOCALE" default:"en"`
+	// the outbox worker runs with the background jobs, see JOBS_ENABLED
+	OutboxMaxAttempts   int           `env:"MAIL_OUTBOX_MAX_ATTEMPTS" default:"8"`
+	OutboxRetryDelay    time.Duration `env:"MAIL_OUTBOX_RETRY_SECONDS" default:"30" unit:"1s"`
+	OutboxMaxRetryDelay time.Duration `env:"MAIL_OUTBOX_MAX_RETRY_MINUTES" default:"60" unit:"1m"`
+	OutboxBatchSize     int           `env:"MAIL_OUTBOX_BATCH_SIZE" default:"20"`
+}
+
+// SMTPConfig also holds the sender used by every mail transport
+type SMTPConfig struct {
+	Host      string `env:"SMTP_HOST"`
+	Port      string `env:"SMTP_PORT" default:"587"`
+	Username  string `env:"SMTP_USERNAME"`
+	Password  string `env:"SMTP_PASSWORD" secret:"true"`
+	FromEmail string `env:"SMTP_FROM_EMAIL"`
+	FromName  string `env:"SMTP_FROM_NAME" default:"No Reply"`
+	// Security is starttls, tls (implicit TLS, port 465) or none
+	Security    string        `env:"SMTP_SECURITY" default:"starttls"`
+	Timeout     time.Duration `env:"SMTP_TIMEOUT_SECONDS" default:"10" unit:"1s"`
+	IdleTimeout time.Duration `env:"SMTP_IDLE_TIMEOUT_SECONDS" default:"30" unit:"1s"`
+}
+
+// DKIMConfig signs outgoing mail when DKIM_DOMAIN is set, the public key is
+// published at <DKIM_SELECTOR>._domainkey.<DKIM_DOMAIN>
+type DKIMConfig struct {
+	Domain         string `env:"DKIM_DOMAIN"`
+	Selector       string `env:"DKIM_SELECTOR"`
+	PrivateKeyPath string `env:"DKIM_PRIVATE_KEY_PATH"`
+	// Headers defaults to utils.DefaultDKIMHeaders, From is always signed
+	Headers []string `env:"DKIM_HEADERS"`
+}
+
+type S3Config struct {
+	Endpoint  string `env:"S3_ENDPOINT"`
+	AccessKey string `env:"S3_ACCESS_KEY"`
+	SecretKey string `env:"S3_SECRET_KEY" secret:"true"`
+	SSL       bool   `env:"S3_SSL" default:"false"`
+}
+
+type JobsConfig struct {
+	Enabled      bool          `env:"JOBS_ENABLED" default:"true"`
+	PollInterval time.Duration `env:"JOBS_POLL_INTERVAL_SECONDS" default:"5" unit:"1s"`
+}
+
+// InitConfig loads and validates the whole config, reporting every problem
+// at once, then initializes the utils packages and the database pool.
+func InitConfig(configFile string) (*Config, error) {
+	cfg, err := Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	// init jwt
+	if err := utils.InitJWT(cfg.JWT.toUtils()); err != nil {
+		return nil, err
+	}
+
+	// init email and s3, a broken template stops startup instead of a send
+	emailTemplates, err := utils.LoadEmailTemplates(templates.Email(cfg.Mail.TemplatesDir), cfg.Mail.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	if err := emailTemplates.Check(); err != nil {
+		return nil, fmt.Errorf("invalid email templates:\n%w", err)
+	}
+	transport, err := cfg.Mail.newMailer(cfg.SMTP)
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := cfg.DKIM.wrap(transport)
+	if err != nil {
+		if closer, ok := transport.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+	utils.InitEmail(utils.EmailConfig{
+		FromEmail: cfg.SMTP.FromEmail,
+		FromName:  cfg.SMTP.FromName,
+	}, mailer, emailTemplates)
+
+	// from here on a failed start closes whatever was opened so far
+	started := false
+	defer func() {
+		if !started {
+			cfg.Close()
+		}
+	}()
+
+	if cfg.S3.Endpoint != "" {
+		if err := utils.InitS3(cfg.S3.toUtils()); err != nil {
+			return nil, err
+		}
+	}
+
 	// init db
-	database, err := utils.ConnectDB()
+	database, err := cfg.Database.Connect()
+	if err != nil {
+		return nil, err
+	}
+	cfg.DB = database
+
+	replicas, err := cfg.Database.OpenReplicas()
 	if err != nil {
 		return nil, err
 	}
+	cfg.Replicas = replicas
+
+	started = true
+	log.Printf("Config loaded (APP_ENV=%s)", cfg.App.Env)
+	return cfg, nil
+}
+
+// Close closes the mail transport, the replica pools and then the primary
+func (cfg *Config) Close() {
+	if err := utils.CloseEmail(); err != nil {
+		log.Printf("failed to close mail transport: %v", err)
+	}
+	for _, replica := range cfg.Replicas {
+		replica.Close()
+	}
+	if cfg.DB != nil {
+		cfg.DB.Close()
+	}
+}
+
+// Validate checks every section and joins the problems into one error
+func (cfg *Config) Validate() error {
+	var errs []error
 
-	return &Config{
-		DB: database,
-	}, nil
+	switch cfg.App.Env {
+	case "development", "test", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV must be development, test, staging or production, got %q", cfg.App.Env))
+	}
+	if cfg.HTTP.Port <= 0 || cfg.HTTP.Port > 65535 {
+		errs = append(errs, fmt.Errorf("APP_PORT must be between 1 and 65535"))
+	}
+	// 0 would time out every /api/v1 request at once
+	if cfg.HTTP.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("HTTP_REQUEST_TIMEOUT_SECONDS must be positive"))
+	}
+	if cfg.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("HTTP_SHUTDOWN_TIMEOUT_SECONDS must be positive"))
+	}
+
+	errs = append(errs, cfg.Database.Validate())
+
+	errs = append(errs, cfg.JWT.toUtils().Validate(cfg.App.Env))
+
+	if cfg.SMTP.FromEmail == "" {
+		errs = append(errs, fmt.Errorf("SMTP_FROM_EMAIL must be set"))
+	}
+	switch cfg.Mail.Transport {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			errs = append(errs, fmt.Errorf("SMTP_HOST must be set when MAIL_TRANSPORT=smtp"))
+		}
+		switch cfg.SMTP.Security {
+		case utils.SMTPSecurityStartTLS, utils.SMTPSecurityTLS:
+		case utils.SMTPSecurityNone:
+			if cfg.App.Env == "production" {
+				errs = append(errs, fmt.Errorf("SMTP_SECURITY=none is not allowed in production"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("SMTP_SECURITY must be starttls, tls or none"))
+		}
+	case "file":
+		if cfg.Mail.Dir == "" {
+			errs = append(errs, fmt.Errorf("MAIL_DIR must be set when MAIL_TRANSPORT=file"))
+		}
+	case "memory", "log":
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_TRANSPORT must be smtp, file, memory or log"))
+	}
+	if cfg.DKIM.Domain != "" || cfg.DKIM.Selector != "" || cfg.DKIM.PrivateKeyPath != "" {
+		if cfg.DKIM.Domain == "" || cfg.DKIM.Selector == "" || cfg.DKIM.PrivateKeyPath == "" {
+			errs = append(errs, fmt.Errorf("DKIM_DOMAIN, DKIM_SELECTOR and DKIM_PRIVATE_KEY_PATH must be set together"))
+		}
+	}
+	if cfg.Mail.OutboxMaxAttempts < 1 || cfg.Mail.OutboxBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("MAIL_OUTBOX_MAX_ATTEMPTS and MAIL_OUTBOX_BATCH_SIZE must be at least 1"))
+	}
+	if cfg.Mail.OutboxRetryDelay <= 0 || cfg.Mail.OutboxMaxRetryDelay < cfg.Mail.OutboxRetryDelay {
+		errs = append(errs, fmt.Errorf("MAIL_OUTBOX_RETRY_SECONDS must be positive and within MAIL_OUTBOX_MAX_RETRY_MINUTES"))
+	}
+	if cfg.S3.Endpoint != "" && (cfg.S3.AccessKey == "" || cfg.S3.SecretKey == "") {
+		errs = append(errs, fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY must be set when S3_ENDPOINT is set"))
+	}
+	if cfg.Auth.VerifyTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("AUTH_VERIFY_TOKEN_TTL_HOURS must be positive"))
+	}
+	if cfg.Auth.ResetTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("AUTH_RESET_TOKEN_TTL_MINUTES must be positive"))
+	}
+	if cfg.Auth.RBACCacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("RBAC_CACHE_TTL_SECONDS must be positive"))
+	}
+	if cfg.Jobs.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("JOBS_POLL_INTERVAL_SECONDS must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (database DatabaseConfig) Validate() error {
+	var errs []error
+
+	if database.URL == "" && (database.User == "" || database.Password == "" || database.Host == "" || database.Port == "" || database.Name == "") {
+		errs = append(errs, fmt.Errorf("DATABASE_URL or DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, and DB_NAME must be set"))
+	}
+	if database.MaxConns < 0 || database.MinConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_CONNS and DB_MIN_CONNS must not be negative"))
+	}
+	if len(database.ReplicaURLs) > 0 && database.ReplicaHealthCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("DB_REPLICA_HEALTH_CHECK_SECONDS must be positive"))
+	}
+	if database.MigrateChecksumMode != "warn" && database.MigrateChecksumMode != "fail" {
+		errs = append(errs, fmt.Errorf("MIGRATE_CHECKSUM_MODE must be warn or fail"))
+	}
+	if database.TxMaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("DB_TX_MAX_ATTEMPTS must be at least 1"))
+	}
+	if database.MaxConns > 0 && database.MinConns > database.MaxConns {
+		errs = append(errs, fmt.Errorf("DB_MIN_CONNS must not exceed DB_MAX_CONNS"))
+	}
+	if database.MaxConnIdleTime < 0 || database.MaxConnLifetime < 0 || database.HealthCheckPeriod < 0 ||
+		database.StatementTimeout < 0 || database.ConnectTimeout < 0 || database.SlowQueryThreshold < 0 {
+		errs = append(errs, fmt.Errorf("DB_* durations must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (mail MailConfig) newMailer(smtp SMTPConfig) (utils.Mailer, error) {
+	switch mail.Transport {
+	case "file":
+		return utils.NewFileMailer(mail.Dir)
+	case "memory":
+		return utils.NewMemoryMailer(), nil
+	case "log":
+		return utils.NewLogMailer(), nil
+	default:
+		return utils.NewSMTPMailer(utils.SMTPMailerConfig{
+			Host:        smtp.Host,
+			Port:        smtp.Port,
+			Username:    smtp.Username,
+			Password:    smtp.Password,
+			Security:    smtp.Security,
+			Timeout:     smtp.Timeout,
+			IdleTimeout: smtp.IdleTimeout,
+		})
+	}
+}
+
+// wrap signs mail sent through mailer, or returns it as is without DKIM_DOMAIN
+func (dkim DKIMConfig) wrap(mailer utils.Mailer) (utils.Mailer, error) {
+	if dkim.Domain == "" {
+		return mailer, nil
+	}
+
+	keyPEM, err := os.ReadFile(dkim.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DKIM private key: %w", err)
+	}
+	return utils.NewDKIMMailer(mailer, utils.DKIMConfig{
+		Domain:        dkim.Domain,
+		Selector:      dkim.Selector,
+		PrivateKeyPEM: keyPEM,
+		Headers:       dkim.Headers,
+	})
+}
+
+// Connect opens the pool, used directly by cmd/migration which needs no other section
+func (database DatabaseConfig) Connect() (*pgxpool.Pool, error) {
+	return utils.ConnectDB(database.toUtils())
+}
+
+// OpenReplicas does not ping, db.DB keeps a replica out of rotation until
+// its first health check passes
+func (database DatabaseConfig) OpenReplicas() ([]*pgxpool.Pool, error) {
+	replicas := make([]*pgxpool.Pool, 0, len(database.ReplicaURLs))
+	for i, replicaURL := range database.ReplicaURLs {
+		config := database.toUtils()
+		config.URL = replicaURL
+
+		replica, err := utils.NewDBPool(config)
+		if err != nil {
+			for _, opened := range replicas {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+func (database DatabaseConfig) toUtils() utils.DBConfig {
+	return utils.DBConfig{
+		URL:                database.URL,
+		User:               database.User,
+		Password:           database.Password,
+		Host:               database.Host,
+		Port:               database.Port,
+		Name:               database.Name,
+		SSLMode:            database.SSLMode,
+		MaxConns:           database.MaxConns,
+		MinConns:           database.MinConns,
+		MaxConnIdleTime:    database.MaxConnIdleTime,
+		MaxConnLifetime:    database.MaxConnLifetime,
+		HealthCheckPeriod:  database.HealthCheckPeriod,
+		StatementTimeout:   database.StatementTimeout,
+		ConnectTimeout:     database.ConnectTimeout,
+		SlowQueryThreshold: database.SlowQueryThreshold,
+		LogQueryArgs:       database.LogQueryArgs,
+	}
+}
+
+func (jwt JWTConfig) toUtils() utils.JWTConfig {
+	return utils.JWTConfig{
+		Algorithm:      jwt.Algorithm,
+		PrivateKeyPath: jwt.PrivateKeyPath,
+		KeyID:          jwt.KeyID,
+		VerifyKeyPaths: jwt.VerifyKeyPaths,
+		AccessSecret:   []byte(jwt.AccessSecret),
+		RefreshSecret:  []byte(jwt.RefreshSecret),
+		AccessTTL:      jwt.AccessTTL,
+		RefreshTTL:     jwt.RefreshTTL,
+		Issuer:         jwt.Issuer,
+		Audience:       jwt.Audience,
+	}
+}
+
+func (s3 S3Config) toUtils() utils.S3Config {
+	return utils.S3Config{
+		Endpoint:  s3.Endpoint,
+		AccessKey: s3.AccessKey,
+		SecretKey: s3.SecretKey,
+		UseSSL:    s3.SSL,
+	}
 }
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-template/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the config without validating or connecting anything.
+// configFile is optional, CONFIG_FILE is used when it is empty.
+func Load(configFile string) (*Config, error) {
+	utils.LoadEnv()
+
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+
+	fileValues := map[string]string{}
+	if configFile != "" {
+		var err error
+		fileValues, err = readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lookup := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			return value, true
+		}
+		value, ok := fileValues[key]
+		return value, ok
+	}
+
+	cfg := &Config{}
+	if err := populate(reflect.ValueOf(cfg).Elem(), lookup); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	if cfg.Auth.ResetPasswordURL == "" {
+		cfg.Auth.ResetPasswordURL = cfg.App.URL + "/reset-password"
+	}
+	// only development falls back to well known JWT secrets, Validate
+	// refuses them anywhere else
+	if cfg.App.Env == "development" {
+		if cfg.JWT.AccessSecret == "" && cfg.JWT.Algorithm == "HS256" {
+			log.Printf("Warning: JWT_ACCESS_SECRET is not set, using the development default")
+			cfg.JWT.AccessSecret = "default-access-secret"
+		}
+		if cfg.JWT.RefreshSecret == "" {
+			log.Printf("Warning: JWT_REFRESH_SECRET is not set, using the development default")
+			cfg.JWT.RefreshSecret = "default-refresh-secret"
+		}
+	}
+
+	return cfg, nil
+}
+
+// populate fills every field with an env tag, nested structs are walked
+func populate(value reflect.Value, lookup func(string) (string, bool)) error {
+	var errs []error
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+
+		key, tagged := field.Tag.Lookup("env")
+		if !tagged {
+			if field.Type.Kind() == reflect.Struct && field.IsExported() {
+				errs = append(errs, populate(fieldValue, lookup))
+			}
+			continue
+		}
+
+		raw, found := lookup(key)
+		if !found {
+			raw, found = field.Tag.Lookup("default")
+		}
+		if !found {
+			continue
+		}
+
+		if err := setField(fieldValue, raw, field.Tag.Get("unit")); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, raw, unit string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch field.Interface().(type) {
+	case time.Duration:
+		duration, err := parseDuration(raw, unit)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+	case string:
+		field.SetString(raw)
+	case int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", raw)
+		}
+		field.SetInt(int64(number))
+	case bool:
+		boolean, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", raw)
+		}
+		field.SetBool(boolean)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// parseDuration accepts a bare number in the unit of the field, e.g. "15"
+// for JWT_ACCESS_TTL_MINUTES, or a Go duration such as "90s"
+func parseDuration(raw, unit string) (time.Duration, error) {
+	if unit != "" {
+		if number, err := strconv.Atoi(raw); err == nil {
+			base, err := time.ParseDuration(unit)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(number) * base, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number or a duration such as 90s, got %q", raw)
+	}
+	return duration, nil
+}
+
+// readConfigFile flattens a YAML or JSON file into env style keys
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var document map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".json":
+		err = json.Unmarshal(content, &document)
+	default:
+		return nil, fmt.Errorf("config file must be .yaml, .yml or .json, got %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", document, values)
+	return values, nil
+}
+
+func flatten(prefix string, node any, values map[string]string) {
+	switch typed := node.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			name := strings.ToUpper(key)
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			flatten(name, child, values)
+		}
+	case []any:
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(typed)
+	}
+}
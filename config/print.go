@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const maskedValue = "********"
+
+// Print writes the config as env style lines grouped by section, fields
+// tagged secret:"true" are masked.
+func (cfg *Config) Print(writer io.Writer) {
+	value := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		fmt.Fprintf(writer, "# %s\n", field.Name)
+		printSection(writer, value.Field(i))
+		fmt.Fprintln(writer)
+	}
+}
+
+func printSection(writer io.Writer, section reflect.Value) {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Type().Field(i)
+		key, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		display := formatValue(section.Field(i).Interface())
+		if field.Tag.Get("secret") == "true" && display != "" {
+			display = maskedValue
+		}
+		fmt.Fprintf(writer, "%s=%s\n", key, display)
+	}
+}
+
+func formatValue(value any) string {
+	switch typed := value.(type) {
+	case time.Duration:
+		return typed.String()
+	case []string:
+		return strings.Join(typed, ",")
+	default:
+		return fmt.Sprint(typed)
+	}
+}
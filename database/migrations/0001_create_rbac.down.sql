@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS role_permissions_changed ON role_permissions;
+DROP FUNCTION IF EXISTS notify_rbac_changed();
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
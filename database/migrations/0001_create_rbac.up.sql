@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name        VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name        VARCHAR(128) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_name       VARCHAR(64) NOT NULL REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission_name VARCHAR(128) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (role_name, permission_name)
+);
+
+-- every instance listens on rbac_changed to drop its permission cache
+CREATE OR REPLACE FUNCTION notify_rbac_changed() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('rbac_changed', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER role_permissions_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON role_permissions
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_rbac_changed();
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access'),
+    ('user', 'Default role for registered users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('*', 'Every permission'),
+    ('rbac:manage', 'Manage roles and permissions')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', '*')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS users (
+    id                UUID PRIMARY KEY,
+    name              VARCHAR(100) NOT NULL,
+    email             VARCHAR(255) NOT NULL,
+    password_hash     TEXT NOT NULL,
+    role              VARCHAR(64) NOT NULL DEFAULT 'user' REFERENCES roles(name) ON UPDATE CASCADE,
+    email_verified_at TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (LOWER(email));
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS replaced_by,
+    DROP COLUMN IF EXISTS family_id;
@@ -0,0 +1,13 @@
+-- refresh_tokens.id is the token jti, family_id groups every token rotated
+-- from the same login, i.e. one device session
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS family_id   UUID,
+    ADD COLUMN IF NOT EXISTS replaced_by UUID,
+    ADD COLUMN IF NOT EXISTS user_agent  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ip_address  TEXT NOT NULL DEFAULT '';
+
+UPDATE refresh_tokens SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
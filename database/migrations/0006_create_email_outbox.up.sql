@@ -0,0 +1,25 @@
+-- mail is rendered and stored in the transaction of the change that caused
+-- it, the worker delivers it after the commit
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id              UUID PRIMARY KEY,
+    sender          TEXT NOT NULL,
+    recipients      TEXT[] NOT NULL,
+    subject         TEXT NOT NULL DEFAULT '',
+    data            BYTEA NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts        INT NOT NULL DEFAULT 0,
+    max_attempts    INT NOT NULL,
+    last_error      TEXT,
+    -- also the lease of a claimed entry, it is retried if the worker dies
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS email_outbox_status_created_at_idx ON email_outbox (status, created_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('outbox:manage', 'List, retry and purge queued emails')
+ON CONFLICT (name) DO NOTHING;
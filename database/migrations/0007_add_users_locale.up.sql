@@ -0,0 +1,3 @@
+-- locale picks the language of emails, '' means the Accept-Language of the
+-- request and then MAIL_DEFAULT_LOCALE
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(16) NOT NULL DEFAULT '';
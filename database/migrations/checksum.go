@@ -0,0 +1,128 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrChecksumMismatch means an applied up file was edited afterwards, the
+// database no longer matches what a fresh install would build
+var ErrChecksumMismatch = errors.New("applied migration changed on disk")
+
+const createChecksumTable = `
+	CREATE TABLE IF NOT EXISTS schema_migration_checksums (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+// Checksum is the SHA-256 of the up file of a migration
+func Checksum(fsys fs.FS, file File) (string, error) {
+	content, err := fs.ReadFile(fsys, file.UpFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file.UpFile, err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyChecksums compares the recorded checksums with the files in fsys.
+// Changed files are logged, strict turns them into ErrChecksumMismatch.
+func VerifyChecksums(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, strict bool) error {
+	if _, err := pool.Exec(ctx, createChecksumTable); err != nil {
+		return fmt.Errorf("failed to create schema_migration_checksums: %w", err)
+	}
+
+	rows, err := pool.Query(ctx, `SELECT version, checksum FROM schema_migration_checksums`)
+	if err != nil {
+		return fmt.Errorf("failed to read migration checksums: %w", err)
+	}
+	recorded := make(map[uint]string)
+	var version int64
+	var checksum string
+	_, err = pgx.ForEachRow(rows, []any{&version, &checksum}, func() error {
+		recorded[uint(version)] = checksum
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read migration checksums: %w", err)
+	}
+
+	files, err := List(fsys)
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for _, file := range files {
+		stored, ok := recorded[file.Version]
+		if !ok || file.UpFile == "" {
+			continue
+		}
+		current, err := Checksum(fsys, file)
+		if err != nil {
+			return err
+		}
+		if current != stored {
+			changed = append(changed, file.UpFile)
+			log.Printf("Warning: %s changed after it was applied", file.UpFile)
+		}
+	}
+
+	if strict && len(changed) > 0 {
+		return fmt.Errorf("%w: %v", ErrChecksumMismatch, changed)
+	}
+	return nil
+}
+
+// RecordChecksums makes the table match version: every migration up to it
+// is recorded, later ones are removed after a down. Migrations applied before
+// checksums existed are recorded with their current content.
+func RecordChecksums(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, version uint, applied bool) error {
+	files, err := List(fsys)
+	if err != nil {
+		return err
+	}
+
+	// created apart from the batch, the batch prepares every statement first
+	if _, err := pool.Exec(ctx, createChecksumTable); err != nil {
+		return fmt.Errorf("failed to create schema_migration_checksums: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	if applied {
+		batch.Queue(`DELETE FROM schema_migration_checksums WHERE version > $1`, int64(version))
+	} else {
+		batch.Queue(`DELETE FROM schema_migration_checksums`)
+	}
+
+	for _, file := range files {
+		if !applied || file.Version > version || file.UpFile == "" {
+			continue
+		}
+		checksum, err := Checksum(fsys, file)
+		if err != nil {
+			return err
+		}
+		batch.Queue(`
+			INSERT INTO schema_migration_checksums (version, name, checksum)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (version) DO NOTHING`,
+			int64(file.Version), file.Name, checksum,
+		)
+	}
+
+	if err := pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to record migration checksums: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// files are compiled into cmd/api and cmd/migration, so a deployment only
+// ships the binaries
+//
+//go:embed *.sql
+var files embed.FS
+
+// bootLockID serializes MigrateOnBoot across API replicas starting together,
+// it differs from the lock golang-migrate takes for each run
+const bootLockID = 72_616_164
+
+// Source returns the files in dir, or the embedded files when dir is empty
+func Source(dir string) fs.FS {
+	if dir == "" {
+		return files
+	}
+	return os.DirFS(dir)
+}
+
+// New opens golang-migrate on fsys, see Source
+func New(fsys fs.FS, databaseURL string) (*migrate.Migrate, error) {
+	source, err := iofs.New(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init migrate: %w", err)
+	}
+	return m, nil
+}
+
+// MigrateOnBoot applies the embedded migrations while holding an advisory
+// lock, replicas that wait for it find nothing left to do. A dirty state
+// fails instead of being forced, it needs a person to look at the schema.
+// strictChecksums fails on applied migrations that changed, see VerifyChecksums.
+func MigrateOnBoot(ctx context.Context, pool *pgxpool.Pool, strictChecksums bool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, bootLockID); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, bootLockID); err != nil {
+			log.Printf("failed to release migration lock: %v", err)
+		}
+	}()
+
+	m, err := New(files, pool.Config().ConnString())
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("failed to get migration version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty, fix the schema and run cmd/migration -action=force -version=N", version)
+	}
+	if err := VerifyChecksums(ctx, pool, files, strictChecksums); err != nil {
+		return err
+	}
+
+	switch err := m.Up(); {
+	case errors.Is(err, migrate.ErrNoChange):
+		log.Printf("Migrations up to date at version %d", version)
+	case err != nil:
+		return fmt.Errorf("failed to migrate: %w", err)
+	default:
+		version, _, _ = m.Version()
+		log.Printf("Migrated to version %d", version)
+	}
+
+	return RecordChecksums(ctx, pool, files, version, true)
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// File is one migration version with its up and down file names
+type File struct {
+	Version  uint
+	Name     string
+	UpFile   string
+	DownFile string
+}
+
+// List returns the migrations in fsys by version, files that do not follow
+// the NNNN_name.up|down.sql convention are ignored like golang-migrate does
+func List(fsys fs.FS) ([]File, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[uint]*File)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		migration, err := source.Parse(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		file, ok := byVersion[migration.Version]
+		if !ok {
+			file = &File{Version: migration.Version, Name: migration.Identifier}
+			byVersion[migration.Version] = file
+		}
+		switch migration.Direction {
+		case source.Up:
+			file.UpFile = entry.Name()
+		case source.Down:
+			file.DownFile = entry.Name()
+		}
+	}
+
+	files := make([]File, 0, len(byVersion))
+	for _, file := range byVersion {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Version < files[j].Version
+	})
+	return files, nil
+}
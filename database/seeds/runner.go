@@ -0,0 +1,160 @@
+package seeds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go-template/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// seedLockID serializes concurrent seed runs, any constant unique to seeding
+const seedLockID = 72_616_163
+
+type step struct {
+	name string
+	run  func(ctx context.Context, querier db.Querier) error
+}
+
+// Run applies the SQL files in dir/shared and dir/env and the Go seeds of env
+// that are not in seed_history yet, ordered by name, all in one transaction. A failing
+// seed rolls back the whole run. It returns the names that were applied.
+func Run(ctx context.Context, database *db.DB, dir, env string) ([]string, error) {
+	if !slices.Contains(Environments, env) {
+		return nil, fmt.Errorf("unknown seed environment %q, use one of %s", env, strings.Join(Environments, ", "))
+	}
+
+	steps, err := collect(dir, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	err = database.WithTx(ctx, db.TxOptions{}, func(ctx context.Context) error {
+		applied = nil
+		querier := database.Querier(ctx)
+
+		if _, err := querier.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, seedLockID); err != nil {
+			return fmt.Errorf("failed to lock seed history: %w", err)
+		}
+		_, err := querier.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS seed_history (
+				env        VARCHAR(32) NOT NULL,
+				name       VARCHAR(255) NOT NULL,
+				applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (env, name)
+			)`)
+		if err != nil {
+			return fmt.Errorf("failed to create seed_history: %w", err)
+		}
+
+		done, err := history(ctx, querier, env)
+		if err != nil {
+			return err
+		}
+
+		for _, step := range steps {
+			if done[step.name] {
+				continue
+			}
+			if err := step.run(ctx, querier); err != nil {
+				return fmt.Errorf("seed %s/%s failed: %w", env, step.name, err)
+			}
+			_, err := querier.Exec(ctx, `INSERT INTO seed_history (env, name) VALUES ($1, $2)`, env, step.name)
+			if err != nil {
+				return fmt.Errorf("failed to record seed %s/%s: %w", env, step.name, err)
+			}
+			applied = append(applied, step.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// collect merges the *.sql files of dir/shared and dir/env with the Go seeds
+// of env by name
+func collect(dir, env string) ([]step, error) {
+	var steps []step
+	for _, subdir := range []string{sharedDir, env} {
+		sqlSteps, err := collectSQL(filepath.Join(dir, subdir))
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, sqlSteps...)
+	}
+	for _, seed := range goSeeds[env] {
+		steps = append(steps, step{name: seed.Name, run: seed.Run})
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].name < steps[j].name
+	})
+	for i := 1; i < len(steps); i++ {
+		if steps[i].name == steps[i-1].name {
+			return nil, fmt.Errorf("seed name %s/%s is used twice", env, steps[i].name)
+		}
+	}
+
+	if len(steps) == 0 {
+		log.Printf("No seeds found for %s", env)
+	}
+	return steps, nil
+}
+
+func collectSQL(dir string) ([]step, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read seeds: %w", err)
+	}
+
+	var steps []step
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		steps = append(steps, step{
+			name: entry.Name(),
+			run: func(ctx context.Context, querier db.Querier) error {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+				// no arguments, pgx sends the file as one simple query so it
+				// may hold several statements
+				_, err = querier.Exec(ctx, string(content))
+				return err
+			},
+		})
+	}
+	return steps, nil
+}
+
+func history(ctx context.Context, querier db.Querier, env string) (map[string]bool, error) {
+	rows, err := querier.Query(ctx, `SELECT name FROM seed_history WHERE env = $1`, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed_history: %w", err)
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed_history: %w", err)
+	}
+
+	done := make(map[string]bool, len(names))
+	for _, name := range names {
+		done[name] = true
+	}
+	return done, nil
+}
@@ -0,0 +1,45 @@
+package seeds
+
+import (
+	"context"
+
+	"go-template/db"
+)
+
+// Environments are the seed sets, one directory of SQL files each on top of
+// the files in sharedDir
+var Environments = []string{"dev", "test", "demo"}
+
+// sharedDir holds SQL files every environment applies, e.g. the permissions
+const sharedDir = "shared"
+
+// Seed is a Go seed for data SQL cannot build, such as bcrypt password
+// hashes. Name orders it among the SQL files of the same environment, e.g.
+// "0002_users" runs after "0001_permissions.sql".
+type Seed struct {
+	Name string
+	Run  func(ctx context.Context, querier db.Querier) error
+}
+
+// goSeeds lists the Go seeds of every environment
+var goSeeds = map[string][]Seed{
+	"dev": {
+		{Name: "0002_users", Run: seedUsers([]seedUser{
+			{Name: "Admin", Email: "admin@example.com", Role: "admin"},
+			{Name: "User", Email: "user@example.com", Role: "user"},
+		})},
+	},
+	"test": {
+		{Name: "0002_users", Run: seedUsers([]seedUser{
+			{Name: "Test Admin", Email: "admin@test.local", Role: "admin"},
+			{Name: "Test User", Email: "user@test.local", Role: "user"},
+		})},
+	},
+	"demo": {
+		{Name: "0002_users", Run: seedUsers([]seedUser{
+			{Name: "Demo Admin", Email: "admin@demo.local", Role: "admin"},
+			{Name: "Demo Moderator", Email: "moderator@demo.local", Role: "moderator"},
+			{Name: "Demo User", Email: "user@demo.local", Role: "user"},
+		})},
+	},
+}
@@ -0,0 +1,18 @@
+-- example role and permissions, applied to every seed set
+INSERT INTO roles (name, description) VALUES
+    ('moderator', 'Example role with read and write access to module 1')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('module-1:read', 'Read module 1 resources'),
+    ('module-1:write', 'Create and update own module 1 resources'),
+    ('module-1:write:any', 'Create and update module 1 resources of any user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('user', 'module-1:read'),
+    ('user', 'module-1:write'),
+    ('moderator', 'module-1:read'),
+    ('moderator', 'module-1:write'),
+    ('moderator', 'module-1:write:any')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,54 @@
+package seeds
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go-template/db"
+	"go-template/utils"
+)
+
+// defaultSeedPassword is used by seeded accounts unless SEED_USER_PASSWORD
+// is set. A set with an admin account requires SEED_USER_PASSWORD, a well
+// known admin password must not reach a shared test or demo database.
+const defaultSeedPassword = "password123"
+
+type seedUser struct {
+	Name  string
+	Email string
+	Role  string
+}
+
+// seedUsers creates verified accounts, existing emails are left untouched
+func seedUsers(users []seedUser) func(ctx context.Context, querier db.Querier) error {
+	return func(ctx context.Context, querier db.Querier) error {
+		password := os.Getenv("SEED_USER_PASSWORD")
+		if password == "" {
+			for _, user := range users {
+				if user.Role == "admin" {
+					return fmt.Errorf("SEED_USER_PASSWORD must be set to seed the admin account %s", user.Email)
+				}
+			}
+			password = defaultSeedPassword
+		}
+
+		passwordHash, err := utils.HashPassword(password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		for _, user := range users {
+			_, err := querier.Exec(ctx, `
+				INSERT INTO users (id, name, email, password_hash, role, email_verified_at)
+				VALUES ($1, $2, $3, $4, $5, NOW())
+				ON CONFLICT ((LOWER(email))) DO NOTHING`,
+				utils.GenerateUUIDv7(), user.Name, user.Email, passwordHash, user.Role,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to seed user %s: %w", user.Email, err)
+			}
+		}
+		return nil
+	}
+}
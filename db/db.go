@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier is satisfied by *pgxpool.Pool, pgx.Tx and *DB, so repository code
+// runs the same inside and outside a transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+var (
+	_ Querier = (*pgxpool.Pool)(nil)
+	_ Querier = (pgx.Tx)(nil)
+	_ Querier = (*DB)(nil)
+)
+
+// DB wraps the pool and joins the transaction started by WithTx, repositories
+// keep one *DB and every call made with the ctx passed to fn runs in the
+// transaction.
+//
+// Example:
+//
+//	err := database.WithTx(ctx, db.TxOptions{}, func(ctx context.Context) error {
+//		if err := users.UpdatePassword(ctx, userID, hash); err != nil {
+//			return err
+//		}
+//		return tokens.RevokeAll(ctx, userID)
+//	})
+type DB struct {
+	pool     *pgxpool.Pool
+	replicas []*replica
+	// next spreads reads round robin over the healthy replicas
+	next                atomic.Uint64
+	healthCheckInterval time.Duration
+	retry               RetryPolicy
+}
+
+type Options struct {
+	// Replicas serve reads outside WithTx, see Reader and MonitorReplicas
+	Replicas            []*pgxpool.Pool
+	HealthCheckInterval time.Duration
+	// Retry zero fields are filled from DefaultRetryPolicy
+	Retry RetryPolicy
+}
+
+func New(pool *pgxpool.Pool, options Options) *DB {
+	retry := options.Retry
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if retry.BaseDelay <= 0 {
+		retry.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if retry.MaxDelay <= 0 {
+		retry.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+
+	healthCheckInterval := options.HealthCheckInterval
+	if healthCheckInterval <= 0 {
+		healthCheckInterval = defaultHealthCheckInterval
+	}
+
+	replicas := make([]*replica, 0, len(options.Replicas))
+	for _, pool := range options.Replicas {
+		replicas = append(replicas, &replica{pool: pool})
+	}
+
+	return &DB{pool: pool, replicas: replicas, healthCheckInterval: healthCheckInterval, retry: retry}
+}
+
+// Pool is for work that needs a dedicated connection, e.g. LISTEN
+func (db *DB) Pool() *pgxpool.Pool {
+	return db.pool
+}
+
+// Querier returns the transaction of ctx, or the primary outside WithTx,
+// whatever the statement looks like. Exec, SendBatch and CopyFrom use it.
+func (db *DB) Querier(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db.pool
+}
+
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return db.Querier(ctx).Exec(ctx, sql, args...)
+}
+
+// Query sends a plain SELECT to Reader, so outside WithTx and without
+// WithReadYourWrites it may run on a replica. Writes, e.g. INSERT ...
+// RETURNING, and SELECT ... FOR UPDATE reach the primary.
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return db.route(ctx, sql).Query(ctx, sql, args...)
+}
+
+// QueryRow is routed like Query
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return db.route(ctx, sql).QueryRow(ctx, sql, args...)
+}
+
+func (db *DB) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	return db.Querier(ctx).SendBatch(ctx, batch)
+}
+
+func (db *DB) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return db.Querier(ctx).CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (db *DB) route(ctx context.Context, sql string) Querier {
+	if isReadOnly(sql) {
+		return db.Reader(ctx)
+	}
+	return db.Querier(ctx)
+}
+
+type txKey struct{}
+
+// TxFromContext reports the transaction WithTx stored in ctx
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+func contextWithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+type replica struct {
+	pool *pgxpool.Pool
+	// healthy starts false, a replica serves reads once a ping succeeded
+	healthy atomic.Bool
+}
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites sends every read made with the returned ctx to the
+// primary, for reads that must see a write made just before, e.g. a token
+// issued by the previous request.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func isReadYourWrites(ctx context.Context) bool {
+	readYourWrites, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return readYourWrites
+}
+
+// Reader is where DB.Query and DB.QueryRow send a plain SELECT. It returns
+// the transaction of ctx inside WithTx, the primary when ctx is marked
+// WithReadYourWrites or no replica is healthy, and a healthy replica otherwise.
+// Call it directly for reads the routing does not recognise, e.g. a WITH.
+//
+// Example:
+//
+//	rows, err := repository.db.Reader(ctx).Query(ctx, `WITH recent AS (...) SELECT ...`)
+func (db *DB) Reader(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	if len(db.replicas) == 0 || isReadYourWrites(ctx) {
+		return db.pool
+	}
+
+	start := db.next.Add(1)
+	for i := range uint64(len(db.replicas)) {
+		replica := db.replicas[(start+i)%uint64(len(db.replicas))]
+		if replica.healthy.Load() {
+			return replica.pool
+		}
+	}
+	return db.pool
+}
+
+// lockingClause needs the primary even in a SELECT
+var lockingClause = regexp.MustCompile(`(?i)\bFOR\s+(UPDATE|NO\s+KEY\s+UPDATE|SHARE|KEY\s+SHARE)\b`)
+
+// isReadOnly recognises a SELECT without a locking clause. Anything else,
+// WITH included since it may wrap a write, goes to the primary. A SELECT of a
+// function with side effects, e.g. nextval, has to use Querier.
+func isReadOnly(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	for strings.HasPrefix(sql, "--") {
+		_, rest, _ := strings.Cut(sql, "\n")
+		sql = strings.TrimSpace(rest)
+	}
+
+	keyword := sql
+	if end := strings.IndexFunc(sql, func(char rune) bool {
+		return char == ' ' || char == '\t' || char == '\n' || char == '\r' || char == '('
+	}); end >= 0 {
+		keyword = sql[:end]
+	}
+	return strings.EqualFold(keyword, "SELECT") && !lockingClause.MatchString(sql)
+}
+
+// MonitorReplicas pings every replica each health check interval, ejects the
+// ones that fail and brings them back once they answer again. It blocks
+// until ctx is cancelled and returns at once without replicas.
+func (db *DB) MonitorReplicas(ctx context.Context) {
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(db.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		db.checkReplicas(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (db *DB) checkReplicas(ctx context.Context) {
+	// a replica slower than half the interval is as good as down
+	ctx, cancel := context.WithTimeout(ctx, db.healthCheckInterval/2)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, replica := range db.replicas {
+		wg.Go(func() {
+			err := replica.pool.Ping(ctx)
+			healthy := err == nil
+
+			if replica.healthy.Swap(healthy) == healthy {
+				return
+			}
+			host := replica.pool.Config().ConnConfig.Host
+			if healthy {
+				log.Printf("db: replica %d (%s) is healthy, serving reads", i+1, host)
+			} else {
+				log.Printf("db: replica %d (%s) ejected: %v", i+1, host, err)
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+type TxOptions struct {
+	IsoLevel   pgx.TxIsoLevel
+	AccessMode pgx.TxAccessMode
+	// Retry overrides the policy of the DB for this call
+	Retry *RetryPolicy
+}
+
+// RetryPolicy re-runs a transaction that failed with a serialization failure
+// or a deadlock. fn runs again from the start, so it must not have side
+// effects outside the database, send emails after WithTx returns.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try, 1 disables retries
+	MaxAttempts int
+	// BaseDelay doubles after every attempt up to MaxDelay, with jitter
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    250 * time.Millisecond,
+}
+
+// WithTx runs fn in a transaction, commits when fn returns nil and rolls back
+// on an error or a panic. Called with a ctx that already holds a transaction
+// it runs fn in a savepoint instead, options are then ignored and only the
+// outermost call retries.
+func (db *DB) WithTx(ctx context.Context, options TxOptions, fn func(ctx context.Context) error) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		return run(ctx, savepoint, fn)
+	}
+
+	policy := db.retry
+	if options.Retry != nil {
+		policy = *options.Retry
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.runTx(ctx, options, fn)
+		if err == nil || attempt >= policy.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.delay(attempt)):
+		}
+	}
+}
+
+func (db *DB) runTx(ctx context.Context, options TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: options.IsoLevel, AccessMode: options.AccessMode})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return run(ctx, tx, fn)
+}
+
+// run commits tx, or rolls it back when fn fails or panics. On a savepoint
+// Commit releases it and Rollback rolls back to it.
+func run(ctx context.Context, tx pgx.Tx, fn func(ctx context.Context) error) error {
+	// roll back even when the request was cancelled, the connection goes
+	// back to the pool
+	rollbackCtx := context.WithoutCancel(ctx)
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_ = tx.Rollback(rollbackCtx)
+			panic(recovered)
+		}
+	}()
+
+	if err := fn(contextWithTx(ctx, tx)); err != nil {
+		if rollbackErr := tx.Rollback(rollbackCtx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			return errors.Join(err, fmt.Errorf("failed to roll back transaction: %w", rollbackErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// IsRetryable reports serialization failures and deadlocks, also when wrapped
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	if policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := policy.BaseDelay << (attempt - 1)
+	if policy.MaxDelay > 0 && (delay > policy.MaxDelay || delay <= 0) {
+		delay = policy.MaxDelay
+	}
+	// half fixed, half random so concurrent retries spread out
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-template/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// error codes returned in the "errors" field of 401 responses
+const (
+	ErrCodeTokenMissing   = "TOKEN_MISSING"
+	ErrCodeTokenExpired   = "TOKEN_EXPIRED"
+	ErrCodeTokenMalformed = "TOKEN_MALFORMED"
+	ErrCodeTokenInvalid   = "TOKEN_INVALID"
+)
+
+type claimsKey struct{}
+
+// Authenticate requires a valid "Authorization: Bearer <access token>" header
+// and stores its *utils.Claims in the request context.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		token, ok := bearerToken(request)
+		if !ok {
+			unauthorized(write, "Authentication required", ErrCodeTokenMissing)
+			return
+		}
+
+		claims, code := validateAccessToken(token)
+		if claims == nil {
+			unauthorized(write, "Invalid access token", code)
+			return
+		}
+
+		next.ServeHTTP(write, request.WithContext(ContextWithClaims(request.Context(), claims)))
+	})
+}
+
+// OptionalAuthenticate lets anonymous requests through for public endpoints.
+// A token that is present but invalid is still rejected, so clients know to refresh it.
+func OptionalAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		token, ok := bearerToken(request)
+		if !ok {
+			next.ServeHTTP(write, request)
+			return
+		}
+
+		claims, code := validateAccessToken(token)
+		if claims == nil {
+			unauthorized(write, "Invalid access token", code)
+			return
+		}
+
+		next.ServeHTTP(write, request.WithContext(ContextWithClaims(request.Context(), claims)))
+	})
+}
+
+func ContextWithClaims(ctx context.Context, claims *utils.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns nil for anonymous requests
+func ClaimsFrom(ctx context.Context) *utils.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*utils.Claims)
+	return claims
+}
+
+func UserIDFrom(ctx context.Context) (string, bool) {
+	claims := ClaimsFrom(ctx)
+	if claims == nil {
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+func RoleFrom(ctx context.Context) (string, bool) {
+	claims := ClaimsFrom(ctx)
+	if claims == nil {
+		return "", false
+	}
+	return claims.Role, true
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	header := request.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func validateAccessToken(token string) (*utils.Claims, string) {
+	claims, err := utils.ValidateAccessToken(token)
+	switch {
+	case err == nil:
+		return claims, ""
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrCodeTokenExpired
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return nil, ErrCodeTokenMalformed
+	default:
+		return nil, ErrCodeTokenInvalid
+	}
+}
+
+func unauthorized(write http.ResponseWriter, message, code string) {
+	if code == ErrCodeTokenMissing {
+		write.Header().Set("WWW-Authenticate", "Bearer")
+	} else {
+		write.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	utils.Error(write, http.StatusUnauthorized, message, map[string]string{"code": code})
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-template/utils"
+)
+
+// Locale stores the Accept-Language preferences in the request context, see
+// utils.LocalesFromContext. Whether a locale is supported is up to the caller.
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		locales := utils.ParseAcceptLanguage(request.Header.Get("Accept-Language"))
+		if len(locales) == 0 {
+			next.ServeHTTP(write, request)
+			return
+		}
+
+		ctx := utils.ContextWithLocales(request.Context(), locales)
+		next.ServeHTTP(write, request.WithContext(ctx))
+	})
+}
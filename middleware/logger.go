@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-template/utils"
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	if !recorder.wroteHeader {
+		recorder.WriteHeader(http.StatusOK)
+	}
+	n, err := recorder.ResponseWriter.Write(data)
+	recorder.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// Logger writes one structured log line per request, with the number of SQL
+// statements the request ran. Register it before Recover so panics are logged
+// with their 500 status.
+func Logger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: write, status: http.StatusOK}
+
+		ctx, queryStats := utils.ContextWithQueryStats(request.Context())
+		request = request.WithContext(ctx)
+
+		next.ServeHTTP(recorder, request)
+
+		// log the path template, not the raw path, so /users/{id} groups together
+		path := utils.RoutePattern(request)
+		if _, template, found := strings.Cut(path, " "); found {
+			path = template
+		}
+		if path == "" {
+			path = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.LogAttrs(request.Context(), level, "http request",
+			slog.String("request_id", utils.RequestIDFromContext(request.Context())),
+			slog.String("method", request.Method),
+			slog.String("path", path),
+			slog.Int("status", recorder.status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", recorder.bytes),
+			slog.Int64("queries", queryStats.Queries()),
+			slog.Int64("query_errors", queryStats.Errors()),
+		)
+	})
+}
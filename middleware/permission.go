@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"go-template/utils"
+)
+
+const ErrCodePermissionDenied = "PERMISSION_DENIED"
+
+// PermissionChecker is implemented by rbac.Service
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, role, permission string) (bool, error)
+}
+
+type Guard struct {
+	checker PermissionChecker
+}
+
+func NewGuard(checker PermissionChecker) *Guard {
+	return &Guard{checker: checker}
+}
+
+// RequirePermission rejects callers whose role lacks any of the permissions.
+// It must run after Authenticate.
+// Example: group.POST("/invoices", controller.Create, guard.RequirePermission("invoices:write"))
+func (guard *Guard) RequirePermission(permissions ...string) utils.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+			role, ok := RoleFrom(request.Context())
+			if !ok {
+				unauthorized(write, "Authentication required", ErrCodeTokenMissing)
+				return
+			}
+
+			for _, permission := range permissions {
+				allowed, err := guard.checker.HasPermission(request.Context(), role, permission)
+				if err != nil {
+					slog.ErrorContext(request.Context(), "permission check failed",
+						"request_id", utils.RequestIDFromContext(request.Context()),
+						"permission", permission,
+						"error", err,
+					)
+					utils.Error(write, http.StatusInternalServerError, "Internal server error", nil)
+					return
+				}
+				if !allowed {
+					utils.Error(write, http.StatusForbidden, "You do not have permission to perform this action",
+						map[string]string{"code": ErrCodePermissionDenied, "permission": permission})
+					return
+				}
+			}
+
+			next.ServeHTTP(write, request)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"go-template/utils"
+)
+
+// Recover turns a panic into a 500 response so one bad handler does not
+// kill the connection. http.ErrAbortHandler is re-raised as the server expects.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		recorder := &responseRecorder{ResponseWriter: write}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.ErrorContext(request.Context(), "panic recovered",
+				"request_id", utils.RequestIDFromContext(request.Context()),
+				"method", request.Method,
+				"path", request.URL.Path,
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+
+			// too late to change the response once the header is out
+			if recorder.wroteHeader {
+				return
+			}
+			utils.Error(recorder, http.StatusInternalServerError, "Internal server error", nil)
+		}()
+
+		next.ServeHTTP(recorder, request)
+	})
+}
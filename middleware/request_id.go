@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-template/utils"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits how much of an incoming X-Request-ID is trusted
+const maxRequestIDLength = 128
+
+// RequestID reuses the incoming X-Request-ID or generates a UUIDv7,
+// stores it in the request context and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = utils.GenerateUUIDv7()
+		}
+
+		write.Header().Set(RequestIDHeader, requestID)
+		ctx := utils.ContextWithRequestID(request.Context(), requestID)
+		next.ServeHTTP(write, request.WithContext(ctx))
+	})
+}
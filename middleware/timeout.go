@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-template/utils"
+)
+
+// Timeout cancels the request context after duration and replies 503 if the
+// handler has not finished by then. The handler output is buffered in memory,
+// which is fine for the JSON responses of /api/v1 where it wraps the whole
+// group: they are small and list endpoints cap their page size. Streams and
+// large downloads belong on a route outside such a group, with a per-route
+// Timeout if any, e.g. group.GET("/report", controller.Report, middleware.Timeout(30*time.Second)).
+func Timeout(duration time.Duration) utils.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+			ctx, cancel := context.WithTimeout(request.Context(), duration)
+			defer cancel()
+
+			buffered := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						panicked <- recovered
+					}
+				}()
+				next.ServeHTTP(buffered, request.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case recovered := <-panicked:
+				// re-raise on the serving goroutine so Recover can handle it
+				panic(recovered)
+			case <-done:
+				buffered.mu.Lock()
+				defer buffered.mu.Unlock()
+
+				destination := write.Header()
+				for key, values := range buffered.header {
+					destination[key] = values
+				}
+				if buffered.status == 0 {
+					buffered.status = http.StatusOK
+				}
+				write.WriteHeader(buffered.status)
+				_, _ = write.Write(buffered.body.Bytes())
+			case <-ctx.Done():
+				buffered.mu.Lock()
+				defer buffered.mu.Unlock()
+
+				buffered.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					utils.Error(write, http.StatusServiceUnavailable, "Request timeout", nil)
+				}
+			}
+		})
+	}
+}
+
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (writer *timeoutWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *timeoutWriter) WriteHeader(status int) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.timedOut || writer.status != 0 {
+		return
+	}
+	writer.status = status
+}
+
+func (writer *timeoutWriter) Write(data []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+	return writer.body.Write(data)
+}
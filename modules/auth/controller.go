@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"go-template/middleware"
+	"go-template/utils"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+func (controller *Controller) RegisterRoutes(group *utils.RouteGroup) {
+	group.POST("/register", controller.Register)
+	group.POST("/login", controller.Login)
+	group.POST("/refresh", controller.Refresh)
+	group.POST("/logout", controller.Logout)
+	group.GET("/verify-email", controller.VerifyEmail)
+	group.POST("/verify-email/resend", controller.ResendVerification)
+	group.POST("/forgot-password", controller.ForgotPassword)
+	group.POST("/reset-password", controller.ResetPassword)
+
+	group.POST("/logout-all", controller.LogoutAll, middleware.Authenticate)
+	group.GET("/sessions", controller.ListSessions, middleware.Authenticate)
+	group.DELETE("/sessions/{id}", controller.RevokeSession, middleware.Authenticate)
+	group.PUT("/locale", controller.UpdateLocale, middleware.Authenticate)
+}
+
+func (controller *Controller) Register(write http.ResponseWriter, request *http.Request) {
+	var payload RegisterRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	user, err := controller.service.Register(request.Context(), payload)
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.JSON(write, http.StatusCreated, utils.Response{
+		Success: true,
+		Message: "Registration successful, please check your email to verify your account",
+		Data:    user,
+	})
+}
+
+func (controller *Controller) Login(write http.ResponseWriter, request *http.Request) {
+	var payload LoginRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	tokens, err := controller.service.Login(request.Context(), payload, clientInfo(request))
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, tokens, "Login successful")
+}
+
+func (controller *Controller) Refresh(write http.ResponseWriter, request *http.Request) {
+	var payload RefreshRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	tokens, err := controller.service.Refresh(request.Context(), payload, clientInfo(request))
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, tokens, "Token refreshed successfully")
+}
+
+func (controller *Controller) Logout(write http.ResponseWriter, request *http.Request) {
+	var payload RefreshRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	if err := controller.service.Logout(request.Context(), payload); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Logout successful")
+}
+
+func (controller *Controller) VerifyEmail(write http.ResponseWriter, request *http.Request) {
+	token := request.URL.Query().Get("token")
+	if err := controller.service.VerifyEmail(request.Context(), token); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Email verified successfully")
+}
+
+func (controller *Controller) ResendVerification(write http.ResponseWriter, request *http.Request) {
+	var payload ResendVerificationRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	if err := controller.service.ResendVerification(request.Context(), payload); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "If the email is registered and not verified yet, a new verification link has been sent")
+}
+
+func (controller *Controller) ForgotPassword(write http.ResponseWriter, request *http.Request) {
+	var payload ForgotPasswordRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	if err := controller.service.ForgotPassword(request.Context(), payload); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "If the email is registered, a password reset link has been sent")
+}
+
+func (controller *Controller) ResetPassword(write http.ResponseWriter, request *http.Request) {
+	var payload ResetPasswordRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	if err := controller.service.ResetPassword(request.Context(), payload); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Password has been reset, please log in again")
+}
+
+func (controller *Controller) LogoutAll(write http.ResponseWriter, request *http.Request) {
+	userID, _ := middleware.UserIDFrom(request.Context())
+	if err := controller.service.LogoutAll(request.Context(), userID); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Logged out from every device")
+}
+
+func (controller *Controller) ListSessions(write http.ResponseWriter, request *http.Request) {
+	claims := middleware.ClaimsFrom(request.Context())
+	sessions, err := controller.service.ListSessions(request.Context(), claims.UserID, claims.FamilyID)
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, sessions, "Sessions retrieved successfully")
+}
+
+func (controller *Controller) RevokeSession(write http.ResponseWriter, request *http.Request) {
+	userID, _ := middleware.UserIDFrom(request.Context())
+	if err := controller.service.RevokeSession(request.Context(), userID, utils.PathParam(request, "id")); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Session revoked successfully")
+}
+
+func (controller *Controller) UpdateLocale(write http.ResponseWriter, request *http.Request) {
+	var payload UpdateLocaleRequest
+	if !decodeAndValidate(write, request, &payload) {
+		return
+	}
+
+	userID, _ := middleware.UserIDFrom(request.Context())
+	locale, err := controller.service.UpdateLocale(request.Context(), userID, payload)
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, map[string]string{"locale": locale}, "Locale updated successfully")
+}
+
+func (controller *Controller) handleError(write http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrEmailTaken):
+		utils.Error(write, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidToken):
+		utils.Error(write, http.StatusUnauthorized, err.Error(), nil)
+	case errors.Is(err, ErrTokenReused):
+		utils.Error(write, http.StatusUnauthorized, err.Error(), map[string]string{"code": "TOKEN_REUSED"})
+	case errors.Is(err, ErrUnsupportedLocale):
+		utils.Error(write, http.StatusUnprocessableEntity, err.Error(), map[string][]string{"supported": utils.EmailLocales()})
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrUserNotFound):
+		utils.Error(write, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrEmailNotVerified):
+		utils.Error(write, http.StatusForbidden, err.Error(), map[string]string{"code": "EMAIL_NOT_VERIFIED"})
+	default:
+		log.Printf("auth: %v", err)
+		utils.Error(write, http.StatusInternalServerError, "Internal server error", nil)
+	}
+}
+
+// clientInfo only trusts RemoteAddr, X-Forwarded-For can be set by any client
+func clientInfo(request *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		ip = request.RemoteAddr
+	}
+	return ClientInfo{UserAgent: request.UserAgent(), IPAddress: ip}
+}
+
+func decodeAndValidate(write http.ResponseWriter, request *http.Request, payload any) bool {
+	if err := utils.DecodeJSON(write, request, payload); err != nil {
+		utils.Error(write, http.StatusBadRequest, "Invalid request body", []string{err.Error()})
+		return false
+	}
+	if errs := utils.ValidateStruct(payload); errs != nil {
+		utils.Error(write, http.StatusUnprocessableEntity, "Validation failed", errs)
+		return false
+	}
+	return true
+}
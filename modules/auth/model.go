@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailNotVerified   = errors.New("email is not verified")
+	ErrInvalidToken       = errors.New("token is invalid or expired")
+	ErrTokenReused        = errors.New("refresh token was already used, all sessions of this login are revoked")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUnsupportedLocale  = errors.New("locale is not supported")
+)
+
+type User struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"`
+	Role            string     `json:"role"`
+	Locale          string     `json:"locale"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// RefreshToken is a stored refresh token, ID is the token jti
+type RefreshToken struct {
+	ID         string
+	UserID     string
+	FamilyID   string
+	TokenHash  string
+	ReplacedBy *string
+	UserAgent  string
+	IPAddress  string
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Session is one login, i.e. one refresh token family
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ClientInfo describes the device a refresh token is issued to
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+type RegisterRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+	// Locale e.g. "id" or "en-US", only stored when supported
+	Locale string `json:"locale" validate:"omitempty,max=16"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+}
+
+// UpdateLocaleRequest sets the language of emails, "" follows Accept-Language
+type UpdateLocaleRequest struct {
+	Locale string `json:"locale" validate:"max=16"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// VerifyEmailData is rendered by templates/email/verify.<locale>.html
+type VerifyEmailData struct {
+	Name        string
+	VerifyURL   string
+	ExpiredTime string
+}
+
+// ResetPasswordData is rendered by templates/email/reset_password.<locale>.html
+type ResetPasswordData struct {
+	Name        string
+	ResetURL    string
+	ExpiredTime string
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-template/db"
+	"go-template/utils"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const uniqueViolation = "23505"
+
+const userColumns = `id, name, email, password_hash, role, locale, email_verified_at, created_at, updated_at`
+
+type Repository struct {
+	db *db.DB
+}
+
+func NewRepository(database *db.DB) *Repository {
+	return &Repository{db: database}
+}
+
+// WithTx runs fn in one transaction, repository calls made with the ctx
+// passed to fn join it
+func (repository *Repository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return repository.db.WithTx(ctx, db.TxOptions{}, fn)
+}
+
+func (repository *Repository) CreateUser(ctx context.Context, name, email, passwordHash, locale string) (*User, error) {
+	row := repository.db.QueryRow(ctx, `
+		INSERT INTO users (id, name, email, password_hash, locale)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+userColumns,
+		utils.GenerateUUIDv7(), name, email, passwordHash, locale,
+	)
+
+	user, err := scanUser(row)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func (repository *Repository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	row := repository.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
+	return scanUserOrNotFound(row)
+}
+
+func (repository *Repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	row := repository.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER($1)`, email)
+	return scanUserOrNotFound(row)
+}
+
+func (repository *Repository) CreateVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	_, err := repository.db.Exec(ctx, `
+		INSERT INTO email_verification_tokens (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		utils.GenerateUUIDv7(), userID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+	return nil
+}
+
+// ConsumeVerificationToken marks the token used and the user verified. The
+// token is only accepted once, concurrent calls race on the UPDATE.
+func (repository *Repository) ConsumeVerificationToken(ctx context.Context, tokenHash string) error {
+	return repository.WithTx(ctx, func(ctx context.Context) error {
+		return repository.consumeVerificationToken(ctx, tokenHash)
+	})
+}
+
+func (repository *Repository) consumeVerificationToken(ctx context.Context, tokenHash string) error {
+	var userID string
+	err := repository.db.QueryRow(ctx, `
+		UPDATE email_verification_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to consume verification token: %w", err)
+	}
+
+	_, err = repository.db.Exec(ctx, `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to verify user: %w", err)
+	}
+	return nil
+}
+
+func (repository *Repository) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	_, err := repository.db.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.UserAgent, token.IPAddress, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+func (repository *Repository) GetRefreshToken(ctx context.Context, id string) (*RefreshToken, error) {
+	var token RefreshToken
+	// the token may have been issued by the previous request, a lagging
+	// replica would reject it
+	err := repository.db.QueryRow(db.WithReadYourWrites(ctx), `
+		SELECT id, user_id, family_id, token_hash, replaced_by, user_agent, ip_address, expires_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE id = $1`,
+		id,
+	).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ReplacedBy,
+		&token.UserAgent, &token.IPAddress, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenRotated returns false when the token was already rotated or
+// revoked, e.g. by a concurrent refresh with the same token.
+func (repository *Repository) MarkRefreshTokenRotated(ctx context.Context, id, replacedBy string) (bool, error) {
+	tag, err := repository.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET replaced_by = $2
+		WHERE id = $1 AND replaced_by IS NULL AND revoked_at IS NULL`,
+		id, replacedBy,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (repository *Repository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := repository.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (repository *Repository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	_, err := repository.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession revokes a family only when it belongs to userID
+func (repository *Repository) RevokeSession(ctx context.Context, userID, familyID string) error {
+	tag, err := repository.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL`,
+		userID, familyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ListSessions returns one row per family that still has a usable token, it
+// may lag behind on a replica
+func (repository *Repository) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	rows, err := repository.db.Query(ctx, `
+		SELECT t.family_id, t.user_agent, t.ip_address,
+			(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id),
+			t.created_at, t.expires_at
+		FROM refresh_tokens t
+		WHERE t.user_id = $1
+			AND t.revoked_at IS NULL
+			AND t.replaced_by IS NULL
+			AND t.expires_at > NOW()
+		ORDER BY t.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Session, error) {
+		var session Session
+		err := row.Scan(&session.ID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		return session, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (repository *Repository) CreatePasswordResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	_, err := repository.db.Exec(ctx, `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		utils.GenerateUUIDv7(), userID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+// ConsumePasswordResetToken marks the token used and returns its user ID
+func (repository *Repository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+	err := repository.db.QueryRow(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+	return userID, nil
+}
+
+func (repository *Repository) UpdateLocale(ctx context.Context, userID, locale string) error {
+	tag, err := repository.db.Exec(ctx,
+		`UPDATE users SET locale = $2, updated_at = NOW() WHERE id = $1`,
+		userID, locale,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update locale: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePassword also invalidates every outstanding reset token of the user
+func (repository *Repository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	return repository.WithTx(ctx, func(ctx context.Context) error {
+		return repository.updatePassword(ctx, userID, passwordHash)
+	})
+}
+
+func (repository *Repository) updatePassword(ctx context.Context, userID, passwordHash string) error {
+	tag, err := repository.db.Exec(ctx,
+		`UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`,
+		userID, passwordHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = repository.db.Exec(ctx,
+		`UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+	return nil
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role,
+		&user.Locale, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func scanUserOrNotFound(row pgx.Row) (*User, error) {
+	user, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
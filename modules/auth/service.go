@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-template/modules/outbox"
+	"go-template/utils"
+
+	"github.com/google/uuid"
+)
+
+var (
+	verifyEmail        = utils.NewEmailTemplate[VerifyEmailData]("verify")
+	resetPasswordEmail = utils.NewEmailTemplate[ResetPasswordData]("reset_password")
+)
+
+const (
+	// emailTimeout bounds queueing emails after the response is written
+	emailTimeout = 30 * time.Second
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so login
+// takes as long for unknown emails as for wrong passwords
+var dummyPasswordHash, _ = utils.HashPassword("dummy-password-for-timing")
+
+type Options struct {
+	AppURL         string
+	VerifyTokenTTL time.Duration
+	// ResetPasswordURL is the frontend page that posts the token to /auth/reset-password
+	ResetPasswordURL string
+	ResetTokenTTL    time.Duration
+	// Background tracks work that outlives its request, main waits for it
+	// before closing the pools
+	Background *sync.WaitGroup
+}
+
+type Service struct {
+	repository *Repository
+	outbox     *outbox.Service
+	options    Options
+}
+
+func NewService(repository *Repository, outboxService *outbox.Service, options Options) *Service {
+	return &Service{repository: repository, outbox: outboxService, options: options}
+}
+
+// Register creates the user, the verification token and the queued email
+// together
+func (service *Service) Register(ctx context.Context, request RegisterRequest) (*User, error) {
+	passwordHash, err := utils.HashPassword(request.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// an unsupported locale is not stored, emails then follow Accept-Language
+	locale, ok := utils.MatchEmailLocale(request.Locale)
+	if !ok {
+		locale = ""
+	}
+
+	var user *User
+	err = service.repository.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = service.repository.CreateUser(ctx, strings.TrimSpace(request.Name), strings.TrimSpace(request.Email), passwordHash, locale)
+		if err != nil {
+			return err
+		}
+		token, err := service.createVerificationToken(ctx, user)
+		if err != nil {
+			return err
+		}
+		return service.queueVerificationEmail(ctx, user, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (service *Service) Login(ctx context.Context, request LoginRequest, client ClientInfo) (*TokenResponse, error) {
+	user, err := service.repository.GetUserByEmail(ctx, strings.TrimSpace(request.Email))
+	if errors.Is(err, ErrUserNotFound) {
+		utils.CheckPasswordHash(request.Password, dummyPasswordHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPasswordHash(request.Password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	return service.issueTokens(ctx, user, utils.GenerateUUIDv7(), client)
+}
+
+// Refresh rotates the refresh token. Presenting a token that was already
+// rotated out means it leaked, so the whole family is revoked.
+func (service *Service) Refresh(ctx context.Context, request RefreshRequest, client ClientInfo) (*TokenResponse, error) {
+	token, err := service.storedRefreshToken(ctx, request.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ReplacedBy != nil {
+		if err := service.repository.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		log.Printf("refresh token reuse detected, revoked family %s of user %s", token.FamilyID, token.UserID)
+		return nil, ErrTokenReused
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	// reload the user so role changes apply on the next access token
+	user, err := service.repository.GetUserByID(ctx, token.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the old token is only marked rotated when the new one is stored
+	var tokens *TokenResponse
+	err = service.repository.WithTx(ctx, func(ctx context.Context) error {
+		nextID := utils.GenerateUUIDv7()
+		rotated, err := service.repository.MarkRefreshTokenRotated(ctx, token.ID, nextID)
+		if err != nil {
+			return err
+		}
+		if !rotated {
+			return ErrTokenReused
+		}
+
+		tokens, err = service.issueTokensWithID(ctx, user, nextID, token.FamilyID, client)
+		return err
+	})
+	if errors.Is(err, ErrTokenReused) {
+		// lost the race against another refresh with the same token, revoke
+		// outside the rolled back transaction
+		if err := service.repository.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout revokes the session the refresh token belongs to
+func (service *Service) Logout(ctx context.Context, request RefreshRequest) error {
+	token, err := service.storedRefreshToken(ctx, request.RefreshToken)
+	if err != nil {
+		return err
+	}
+	return service.repository.RevokeRefreshTokenFamily(ctx, token.FamilyID)
+}
+
+// LogoutAll revokes every session of the user
+func (service *Service) LogoutAll(ctx context.Context, userID string) error {
+	return service.repository.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// ListSessions flags the session of currentFamilyID, taken from the access token
+func (service *Service) ListSessions(ctx context.Context, userID, currentFamilyID string) ([]Session, error) {
+	sessions, err := service.repository.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentFamilyID
+	}
+	return sessions, nil
+}
+
+func (service *Service) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+	return service.repository.RevokeSession(ctx, userID, sessionID)
+}
+
+// UpdateLocale stores the supported locale matching request.Locale, e.g. "id"
+// for "id-ID", an empty locale follows Accept-Language again
+func (service *Service) UpdateLocale(ctx context.Context, userID string, request UpdateLocaleRequest) (string, error) {
+	locale := ""
+	if strings.TrimSpace(request.Locale) != "" {
+		var ok bool
+		if locale, ok = utils.MatchEmailLocale(request.Locale); !ok {
+			return "", ErrUnsupportedLocale
+		}
+	}
+
+	if err := service.repository.UpdateLocale(ctx, userID, locale); err != nil {
+		return "", err
+	}
+	return locale, nil
+}
+
+func (service *Service) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+	return service.repository.ConsumeVerificationToken(ctx, utils.HashToken(token))
+}
+
+// ResendVerification does not report whether the email exists
+func (service *Service) ResendVerification(ctx context.Context, request ResendVerificationRequest) error {
+	user, err := service.repository.GetUserByEmail(ctx, strings.TrimSpace(request.Email))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return service.repository.WithTx(ctx, func(ctx context.Context) error {
+		token, err := service.createVerificationToken(ctx, user)
+		if err != nil {
+			return err
+		}
+		return service.queueVerificationEmail(ctx, user, token)
+	})
+}
+
+// ForgotPassword answers the same way whether or not the email is registered.
+// The token and email are handled in the background so response time does
+// not reveal it either.
+func (service *Service) ForgotPassword(ctx context.Context, request ForgotPasswordRequest) error {
+	email := strings.TrimSpace(request.Email)
+
+	service.options.Background.Go(func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), emailTimeout)
+		defer cancel()
+
+		if err := service.queuePasswordResetEmail(ctx, email); err != nil {
+			log.Printf("failed to queue password reset email: %v", err)
+		}
+	})
+
+	return nil
+}
+
+// ResetPassword consumes the token, changes the password and revokes every
+// refresh token so other sessions have to log in again, all or nothing.
+func (service *Service) ResetPassword(ctx context.Context, request ResetPasswordRequest) error {
+	// hash before the transaction, bcrypt is slow
+	passwordHash, err := utils.HashPassword(request.Password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return service.repository.WithTx(ctx, func(ctx context.Context) error {
+		userID, err := service.repository.ConsumePasswordResetToken(ctx, utils.HashToken(request.Token))
+		if err != nil {
+			return err
+		}
+
+		if err := service.repository.UpdatePassword(ctx, userID, passwordHash); err != nil {
+			return err
+		}
+		return service.repository.RevokeUserRefreshTokens(ctx, userID)
+	})
+}
+
+func (service *Service) issueTokens(ctx context.Context, user *User, familyID string, client ClientInfo) (*TokenResponse, error) {
+	return service.issueTokensWithID(ctx, user, utils.GenerateUUIDv7(), familyID, client)
+}
+
+func (service *Service) issueTokensWithID(ctx context.Context, user *User, tokenID, familyID string, client ClientInfo) (*TokenResponse, error) {
+	accessToken, err := utils.GenerateAccessToken(user.ID, user.Role, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, tokenID, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	err = service.repository.CreateRefreshToken(ctx, RefreshToken{
+		ID:        tokenID,
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// storedRefreshToken validates the JWT and loads its row by jti
+func (service *Service) storedRefreshToken(ctx context.Context, refreshToken string) (*RefreshToken, error) {
+	claims, err := utils.ValidateRefreshToken(refreshToken)
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := service.repository.GetRefreshToken(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if token.TokenHash != utils.HashToken(refreshToken) {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// createVerificationToken stores the hash and returns the token for the email
+func (service *Service) createVerificationToken(ctx context.Context, user *User) (string, error) {
+	token := utils.GenerateRandomString(32)
+	expiresAt := time.Now().Add(service.options.VerifyTokenTTL)
+
+	if err := service.repository.CreateVerificationToken(ctx, user.ID, utils.HashToken(token), expiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// emailLocale prefers the locale of the user, then the Accept-Language of the
+// request, then MAIL_DEFAULT_LOCALE
+func emailLocale(ctx context.Context, user *User) string {
+	locale, _ := utils.MatchEmailLocale(append([]string{user.Locale}, utils.LocalesFromContext(ctx)...)...)
+	return locale
+}
+
+func (service *Service) queueVerificationEmail(ctx context.Context, user *User, token string) error {
+	locale := emailLocale(ctx, user)
+	message, err := verifyEmail.Message(locale, VerifyEmailData{
+		Name:        user.Name,
+		VerifyURL:   fmt.Sprintf("%s/api/v1/auth/verify-email?token=%s", service.options.AppURL, url.QueryEscape(token)),
+		ExpiredTime: formatTTL(service.options.VerifyTokenTTL, locale),
+	})
+	if err != nil {
+		return err
+	}
+
+	message.To = []string{user.Email}
+	return service.outbox.Enqueue(ctx, message)
+}
+
+func (service *Service) queuePasswordResetEmail(ctx context.Context, email string) error {
+	user, err := service.repository.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token := utils.GenerateRandomString(32)
+	locale := emailLocale(ctx, user)
+	message, err := resetPasswordEmail.Message(locale, ResetPasswordData{
+		Name:        user.Name,
+		ResetURL:    fmt.Sprintf("%s?token=%s", service.options.ResetPasswordURL, url.QueryEscape(token)),
+		ExpiredTime: formatTTL(service.options.ResetTokenTTL, locale),
+	})
+	if err != nil {
+		return err
+	}
+	message.To = []string{user.Email}
+
+	return service.repository.WithTx(ctx, func(ctx context.Context) error {
+		expiresAt := time.Now().Add(service.options.ResetTokenTTL)
+		if err := service.repository.CreatePasswordResetToken(ctx, user.ID, utils.HashToken(token), expiresAt); err != nil {
+			return err
+		}
+		return service.outbox.Enqueue(ctx, message)
+	})
+}
+
+// formatTTL renders durations for emails in locale, e.g. "24 hours" or
+// "30 menit"
+func formatTTL(ttl time.Duration, locale string) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		return pluralize(int(ttl/time.Hour), "hour", locale)
+	}
+	return pluralize(int(ttl/time.Minute), "minute", locale)
+}
+
+// pluralize uses the "duration.<unit>" and "duration.<unit>s" catalog
+// entries, the latter with a %d for count
+func pluralize(count int, unit, locale string) string {
+	key := "duration." + unit + "s"
+	if count == 1 {
+		key = "duration." + unit
+	}
+
+	format, err := utils.TranslateEmail(locale, key)
+	if err != nil {
+		log.Printf("auth: %v", err)
+		format = "%d " + unit + "s"
+	}
+	if !strings.Contains(format, "%d") {
+		return format
+	}
+	return fmt.Sprintf(format, count)
+}
@@ -1 +1,22 @@
 package module1
+
+import (
+	"go-template/utils"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+// RegisterRoutes mounts the module on the group given by routes.NewRouter.
+// Example:
+//
+//	group.GET("", controller.List)
+//	group.GET("/{id}", controller.GetByID)
+//	group.POST("", controller.Create)
+func (controller *Controller) RegisterRoutes(group *utils.RouteGroup) {
+}
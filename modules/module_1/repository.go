@@ -1 +1,13 @@
 package module1
+
+import (
+	"go-template/db"
+)
+
+type Repository struct {
+	db *db.DB
+}
+
+func NewRepository(database *db.DB) *Repository {
+	return &Repository{db: database}
+}
@@ -1 +1,9 @@
 package module1
+
+type Service struct {
+	repository *Repository
+}
+
+func NewService(repository *Repository) *Service {
+	return &Service{repository: repository}
+}
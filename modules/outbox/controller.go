@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-template/middleware"
+	"go-template/utils"
+
+	"github.com/google/uuid"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+func (controller *Controller) RegisterRoutes(group *utils.RouteGroup, guard *middleware.Guard) {
+	group.Use(middleware.Authenticate, guard.RequirePermission("outbox:manage"))
+
+	group.GET("", controller.List)
+	group.POST("/{id}/retry", controller.Retry)
+	group.DELETE("", controller.Purge)
+}
+
+// List takes ?status=pending|sent|dead and ?limit=, newest first
+func (controller *Controller) List(write http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			utils.Error(write, http.StatusBadRequest, "limit must be a positive number", nil)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := controller.service.List(request.Context(), ListRequest{Status: query.Get("status"), Limit: limit})
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, entries, "Outbox entries retrieved successfully")
+}
+
+func (controller *Controller) Retry(write http.ResponseWriter, request *http.Request) {
+	id := utils.PathParam(request, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		controller.handleError(write, ErrEntryNotFound)
+		return
+	}
+
+	if err := controller.service.Retry(request.Context(), id); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Outbox entry queued for retry")
+}
+
+// Purge takes ?status=sent|dead and ?older_than_days=, 0 deletes every entry
+// of that status
+func (controller *Controller) Purge(write http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	days := 0
+	if value := query.Get("older_than_days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.Error(write, http.StatusBadRequest, "older_than_days must not be negative", nil)
+			return
+		}
+		days = parsed
+	}
+
+	response, err := controller.service.Purge(request.Context(), PurgeRequest{
+		Status:    query.Get("status"),
+		OlderThan: time.Duration(days) * 24 * time.Hour,
+	})
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, response, "Outbox entries purged successfully")
+}
+
+func (controller *Controller) handleError(write http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrEntryNotFound):
+		utils.Error(write, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrPurgePending):
+		utils.Error(write, http.StatusBadRequest, err.Error(), nil)
+	default:
+		log.Printf("outbox: %v", err)
+		utils.Error(write, http.StatusInternalServerError, "Internal server error", nil)
+	}
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrEntryNotFound = errors.New("outbox entry not found")
+	ErrInvalidStatus = errors.New("status must be pending, sent or dead")
+	ErrPurgePending  = errors.New("only sent or dead entries can be purged")
+)
+
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	// StatusDead is set after the last attempt failed, only a retry sends it again
+	StatusDead = "dead"
+)
+
+// Entry is listed to admins, the mail itself is not returned since it holds
+// one time tokens
+type Entry struct {
+	ID            string     `json:"id"`
+	Sender        string     `json:"sender"`
+	Recipients    []string   `json:"recipients"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"max_attempts"`
+	LastError     *string    `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// claimedEntry is a due entry locked by the worker for delivery
+type claimedEntry struct {
+	ID          string
+	Sender      string
+	Recipients  []string
+	Data        []byte
+	Attempts    int
+	MaxAttempts int
+}
+
+type ListRequest struct {
+	Status string
+	Limit  int
+}
+
+// PurgeRequest deletes the entries of Status created before OlderThan
+type PurgeRequest struct {
+	Status    string
+	OlderThan time.Duration
+}
+
+type PurgeResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+func validStatus(status string) bool {
+	return status == StatusPending || status == StatusSent || status == StatusDead
+}
@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-template/db"
+	"go-template/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const entryColumns = `id, sender, recipients, subject, status, attempts, max_attempts, last_error, next_attempt_at, sent_at, created_at`
+
+type Repository struct {
+	db *db.DB
+}
+
+func NewRepository(database *db.DB) *Repository {
+	return &Repository{db: database}
+}
+
+// Insert joins the transaction of ctx, the entry only exists if it commits
+func (repository *Repository) Insert(ctx context.Context, mail utils.Mail, subject string, maxAttempts int) error {
+	_, err := repository.db.Exec(ctx, `
+		INSERT INTO email_outbox (id, sender, recipients, subject, data, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		utils.GenerateUUIDv7(), mail.From, mail.Recipients, subject, mail.Data, maxAttempts,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+	return nil
+}
+
+// Claim takes up to limit due entries and pushes next_attempt_at past lease,
+// so other instances skip them and a crashed worker's entries come back
+func (repository *Repository) Claim(ctx context.Context, limit int, lease time.Duration) ([]claimedEntry, error) {
+	rows, err := repository.db.Query(ctx, `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second', updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, sender, recipients, data, attempts, max_attempts`,
+		limit, int(lease.Seconds()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox entries: %w", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (claimedEntry, error) {
+		var entry claimedEntry
+		err := row.Scan(&entry.ID, &entry.Sender, &entry.Recipients, &entry.Data, &entry.Attempts, &entry.MaxAttempts)
+		return entry, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan outbox entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (repository *Repository) MarkSent(ctx context.Context, id string) error {
+	_, err := repository.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = NULL, updated_at = NOW()
+		WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark email sent: %w", err)
+	}
+	return nil
+}
+
+// Release undoes Claim for entries that were not attempted, the attempt
+// Claim counted is given back
+func (repository *Repository) Release(ctx context.Context, ids []string) error {
+	_, err := repository.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET attempts = GREATEST(attempts - 1, 0), next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = ANY($1::uuid[]) AND status = 'pending'`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to release outbox entries: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed schedules the next attempt, or moves the entry to dead when
+// nextAttemptAt is nil
+func (repository *Repository) MarkFailed(ctx context.Context, id, lastError string, nextAttemptAt *time.Time) error {
+	_, err := repository.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			last_error = $2, updated_at = NOW()
+		WHERE id = $1`, id, lastError, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark email failed: %w", err)
+	}
+	return nil
+}
+
+func (repository *Repository) List(ctx context.Context, status string, limit int) ([]Entry, error) {
+	rows, err := repository.db.Query(ctx, `
+		SELECT `+entryColumns+`
+		FROM email_outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox entries: %w", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Entry, error) {
+		var entry Entry
+		err := row.Scan(&entry.ID, &entry.Sender, &entry.Recipients, &entry.Subject, &entry.Status, &entry.Attempts,
+			&entry.MaxAttempts, &entry.LastError, &entry.NextAttemptAt, &entry.SentAt, &entry.CreatedAt)
+		return entry, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan outbox entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Retry queues a dead or pending entry for an immediate attempt with a fresh
+// attempt count
+func (repository *Repository) Retry(ctx context.Context, id string) error {
+	tag, err := repository.db.Exec(ctx, `
+		UPDATE email_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status <> 'sent'`, id)
+	if err != nil {
+		return fmt.Errorf("failed to retry outbox entry: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+func (repository *Repository) Purge(ctx context.Context, status string, before time.Time) (int64, error) {
+	tag, err := repository.db.Exec(ctx,
+		`DELETE FROM email_outbox WHERE status = $1 AND created_at < $2`, status, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox entries: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
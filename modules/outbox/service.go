@@ -0,0 +1,197 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"go-template/utils"
+)
+
+// claimLease is how long a claimed entry is hidden from other workers, longer
+// than any SMTP timeout
+const claimLease = 5 * time.Minute
+
+// releaseTimeout bounds handing entries back on shutdown
+const releaseTimeout = 5 * time.Second
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+type Options struct {
+	// MaxAttempts counts the first try, the entry is dead after the last one
+	MaxAttempts int
+	// RetryDelay doubles after every failed attempt up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	BatchSize     int
+	PollInterval  time.Duration
+}
+
+// Service stores mail in the email_outbox table and delivers it from Run, so
+// an SMTP outage delays mail instead of failing the request that sent it.
+//
+// Example:
+//
+//	err := database.WithTx(ctx, db.TxOptions{}, func(ctx context.Context) error {
+//		if err := users.Create(ctx, user); err != nil {
+//			return err
+//		}
+//		message, err := welcomeEmail.Message(user.Locale, data)
+//		if err != nil {
+//			return err
+//		}
+//		message.To = []string{user.Email}
+//		return outboxService.Enqueue(ctx, message)
+//	})
+type Service struct {
+	repository *Repository
+	options    Options
+}
+
+func NewService(repository *Repository, options Options) *Service {
+	return &Service{repository: repository, options: options}
+}
+
+// Enqueue renders the message now and stores it in the transaction of ctx,
+// nothing is sent if that transaction rolls back
+func (service *Service) Enqueue(ctx context.Context, message utils.Message) error {
+	mail, err := utils.BuildMail(message)
+	if err != nil {
+		return err
+	}
+	return service.repository.Insert(ctx, mail, message.Subject, service.options.MaxAttempts)
+}
+
+// Run delivers due mail every PollInterval until ctx is cancelled, several
+// instances can run it side by side
+func (service *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// a full batch means more is due, keep going without waiting
+		if service.deliverBatch(ctx) == service.options.BatchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverBatch returns the number of entries claimed
+func (service *Service) deliverBatch(ctx context.Context) int {
+	entries, err := service.repository.Claim(ctx, service.options.BatchSize, claimLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+		}
+		return 0
+	}
+
+	for i, entry := range entries {
+		// on shutdown the rest goes back unsent instead of failing with ctx
+		if ctx.Err() != nil {
+			service.release(entries[i:])
+			break
+		}
+		service.deliver(ctx, entry)
+	}
+	return len(entries)
+}
+
+func (service *Service) deliver(ctx context.Context, entry claimedEntry) {
+	mail := utils.Mail{From: entry.Sender, Recipients: entry.Recipients, Data: entry.Data}
+
+	// the result is stored even when shutdown cancelled ctx mid send
+	storeCtx := context.WithoutCancel(ctx)
+
+	sendErr := utils.DeliverMail(ctx, mail)
+	if sendErr == nil {
+		if err := service.repository.MarkSent(storeCtx, entry.ID); err != nil {
+			log.Printf("outbox: %v", err)
+		}
+		return
+	}
+	// cancelled by shutdown, not a failure of the SMTP server
+	if ctx.Err() != nil {
+		service.release([]claimedEntry{entry})
+		return
+	}
+
+	var nextAttemptAt *time.Time
+	if entry.Attempts < entry.MaxAttempts {
+		next := time.Now().Add(service.retryDelay(entry.Attempts))
+		nextAttemptAt = &next
+		log.Printf("outbox: attempt %d/%d of email %s failed, retrying at %s: %v",
+			entry.Attempts, entry.MaxAttempts, entry.ID, next.Format(time.RFC3339), sendErr)
+	} else {
+		log.Printf("outbox: email %s is dead after %d attempts: %v", entry.ID, entry.Attempts, sendErr)
+	}
+
+	if err := service.repository.MarkFailed(storeCtx, entry.ID, sendErr.Error(), nextAttemptAt); err != nil {
+		log.Printf("outbox: %v", err)
+	}
+}
+
+// release gives claimed entries and their attempt back, so they are due
+// again at once instead of after the claim lease
+func (service *Service) release(entries []claimedEntry) {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	// ctx is already cancelled when this runs
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := service.repository.Release(ctx, ids); err != nil {
+		log.Printf("outbox: %v, the entries are retried after the claim lease", err)
+	}
+}
+
+func (service *Service) retryDelay(attempt int) time.Duration {
+	delay := service.options.RetryDelay << (attempt - 1)
+	if delay > service.options.MaxRetryDelay || delay <= 0 {
+		delay = service.options.MaxRetryDelay
+	}
+	// half fixed, half random so mail held by one outage does not retry at once
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (service *Service) List(ctx context.Context, request ListRequest) ([]Entry, error) {
+	if request.Status != "" && !validStatus(request.Status) {
+		return nil, ErrInvalidStatus
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultListLimit
+	}
+	request.Limit = min(request.Limit, maxListLimit)
+
+	return service.repository.List(ctx, request.Status, request.Limit)
+}
+
+func (service *Service) Retry(ctx context.Context, id string) error {
+	return service.repository.Retry(ctx, id)
+}
+
+// Purge never deletes pending mail, only sent or dead entries
+func (service *Service) Purge(ctx context.Context, request PurgeRequest) (*PurgeResponse, error) {
+	if request.Status != StatusSent && request.Status != StatusDead {
+		return nil, ErrPurgePending
+	}
+
+	deleted, err := service.repository.Purge(ctx, request.Status, time.Now().Add(-request.OlderThan))
+	if err != nil {
+		return nil, err
+	}
+	return &PurgeResponse{Deleted: deleted}, nil
+}
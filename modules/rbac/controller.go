@@ -0,0 +1,128 @@
+package rbac
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"go-template/middleware"
+	"go-template/utils"
+)
+
+type Controller struct {
+	service *Service
+}
+
+func NewController(service *Service) *Controller {
+	return &Controller{service: service}
+}
+
+func (controller *Controller) RegisterRoutes(group *utils.RouteGroup, guard *middleware.Guard) {
+	group.Use(middleware.Authenticate, guard.RequirePermission("rbac:manage"))
+
+	group.GET("/roles", controller.ListRoles)
+	group.POST("/roles", controller.CreateRole)
+	group.DELETE("/roles/{role}", controller.DeleteRole)
+	group.PUT("/roles/{role}/permissions/{permission}", controller.GrantPermission)
+	group.DELETE("/roles/{role}/permissions/{permission}", controller.RevokePermission)
+	group.GET("/permissions", controller.ListPermissions)
+	group.POST("/permissions", controller.CreatePermission)
+}
+
+func (controller *Controller) ListRoles(write http.ResponseWriter, request *http.Request) {
+	roles, err := controller.service.ListRoles(request.Context())
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, roles, "Roles retrieved successfully")
+}
+
+func (controller *Controller) CreateRole(write http.ResponseWriter, request *http.Request) {
+	var payload CreateRoleRequest
+	if err := utils.DecodeJSON(write, request, &payload); err != nil {
+		utils.Error(write, http.StatusBadRequest, "Invalid request body", []string{err.Error()})
+		return
+	}
+	if errs := utils.ValidateStruct(payload); errs != nil {
+		utils.Error(write, http.StatusUnprocessableEntity, "Validation failed", errs)
+		return
+	}
+
+	role, err := controller.service.CreateRole(request.Context(), payload)
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.JSON(write, http.StatusCreated, utils.Response{Success: true, Message: "Role created successfully", Data: role})
+}
+
+func (controller *Controller) DeleteRole(write http.ResponseWriter, request *http.Request) {
+	if err := controller.service.DeleteRole(request.Context(), utils.PathParam(request, "role")); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Role deleted successfully")
+}
+
+func (controller *Controller) GrantPermission(write http.ResponseWriter, request *http.Request) {
+	role := utils.PathParam(request, "role")
+	permission := utils.PathParam(request, "permission")
+
+	if err := controller.service.GrantPermission(request.Context(), role, permission); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Permission granted successfully")
+}
+
+func (controller *Controller) RevokePermission(write http.ResponseWriter, request *http.Request) {
+	role := utils.PathParam(request, "role")
+	permission := utils.PathParam(request, "permission")
+
+	if err := controller.service.RevokePermission(request.Context(), role, permission); err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, nil, "Permission revoked successfully")
+}
+
+func (controller *Controller) ListPermissions(write http.ResponseWriter, request *http.Request) {
+	permissions, err := controller.service.ListPermissions(request.Context())
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.Success(write, permissions, "Permissions retrieved successfully")
+}
+
+func (controller *Controller) CreatePermission(write http.ResponseWriter, request *http.Request) {
+	var payload CreatePermissionRequest
+	if err := utils.DecodeJSON(write, request, &payload); err != nil {
+		utils.Error(write, http.StatusBadRequest, "Invalid request body", []string{err.Error()})
+		return
+	}
+	if errs := utils.ValidateStruct(payload); errs != nil {
+		utils.Error(write, http.StatusUnprocessableEntity, "Validation failed", errs)
+		return
+	}
+
+	permission, err := controller.service.CreatePermission(request.Context(), payload)
+	if err != nil {
+		controller.handleError(write, err)
+		return
+	}
+	utils.JSON(write, http.StatusCreated, utils.Response{Success: true, Message: "Permission created successfully", Data: permission})
+}
+
+func (controller *Controller) handleError(write http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrPermissionNotFound):
+		utils.Error(write, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrAlreadyExists), errors.Is(err, ErrRoleInUse):
+		utils.Error(write, http.StatusConflict, err.Error(), nil)
+	default:
+		log.Printf("rbac: %v", err)
+		utils.Error(write, http.StatusInternalServerError, "Internal server error", nil)
+	}
+}
@@ -0,0 +1,46 @@
+package rbac
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrRoleInUse          = errors.New("role is still assigned to users")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// WildcardPermission grants everything, e.g. to the admin role.
+// "invoices:*" grants every invoices permission.
+const WildcardPermission = "*"
+
+// AnySuffix marks the permission to act on resources owned by other users,
+// e.g. "invoices:write:any", see Authorizer.
+const AnySuffix = ":any"
+
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateRoleRequest struct {
+	Name        string `json:"name" validate:"required,max=64"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+type CreatePermissionRequest struct {
+	Name        string `json:"name" validate:"required,max=128"`
+	Description string `json:"description" validate:"max=255"`
+}
@@ -0,0 +1,230 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-template/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+type Repository struct {
+	db *db.DB
+}
+
+func NewRepository(database *db.DB) *Repository {
+	return &Repository{db: database}
+}
+
+func (repository *Repository) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := repository.db.Query(ctx, `
+		SELECT r.name, r.description, r.created_at,
+			COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name)
+				FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.name
+		GROUP BY r.name
+		ORDER BY r.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	roles, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Role, error) {
+		var role Role
+		err := row.Scan(&role.Name, &role.Description, &role.CreatedAt, &role.Permissions)
+		return role, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (repository *Repository) CreateRole(ctx context.Context, name, description string) (*Role, error) {
+	role := &Role{Name: name, Description: description, Permissions: []string{}}
+	err := repository.db.QueryRow(ctx,
+		`INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING created_at`,
+		name, description,
+	).Scan(&role.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return role, nil
+}
+
+func (repository *Repository) DeleteRole(ctx context.Context, name string) error {
+	tag, err := repository.db.Exec(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return ErrRoleInUse
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (repository *Repository) ListPermissions(ctx context.Context) ([]Permission, error) {
+	rows, err := repository.db.Query(ctx,
+		`SELECT name, description, created_at FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+
+	permissions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[Permission])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+func (repository *Repository) CreatePermission(ctx context.Context, name, description string) (*Permission, error) {
+	permission := &Permission{Name: name, Description: description}
+	err := repository.db.QueryRow(ctx,
+		`INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING created_at`,
+		name, description,
+	).Scan(&permission.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create permission: %w", err)
+	}
+	return permission, nil
+}
+
+func (repository *Repository) GrantPermission(ctx context.Context, role, permission string) error {
+	return repository.db.WithTx(ctx, db.TxOptions{}, func(ctx context.Context) error {
+		return repository.grantPermission(ctx, role, permission)
+	})
+}
+
+func (repository *Repository) grantPermission(ctx context.Context, role, permission string) error {
+	if err := repository.ensureExists(ctx, role, permission); err != nil {
+		return err
+	}
+
+	_, err := repository.db.Exec(ctx,
+		`INSERT INTO role_permissions (role_name, permission_name) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		role, permission,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to grant permission: %w", err)
+	}
+	return nil
+}
+
+func (repository *Repository) RevokePermission(ctx context.Context, role, permission string) error {
+	return repository.db.WithTx(ctx, db.TxOptions{}, func(ctx context.Context) error {
+		return repository.revokePermission(ctx, role, permission)
+	})
+}
+
+func (repository *Repository) revokePermission(ctx context.Context, role, permission string) error {
+	if err := repository.ensureExists(ctx, role, permission); err != nil {
+		return err
+	}
+
+	_, err := repository.db.Exec(ctx,
+		`DELETE FROM role_permissions WHERE role_name = $1 AND permission_name = $2`,
+		role, permission,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke permission: %w", err)
+	}
+	return nil
+}
+
+// LoadRolePermissions returns every role→permission mapping, used to fill the
+// cache. It reads the primary, a lagging replica would cache stale grants
+// right after a rbac_changed notification.
+func (repository *Repository) LoadRolePermissions(ctx context.Context) (map[string]map[string]struct{}, error) {
+	rows, err := repository.db.Query(db.WithReadYourWrites(ctx), `SELECT role_name, permission_name FROM role_permissions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := make(map[string]map[string]struct{})
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		if mappings[role] == nil {
+			mappings[role] = make(map[string]struct{})
+		}
+		mappings[role][permission] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load role permissions: %w", err)
+	}
+	return mappings, nil
+}
+
+// Listen blocks on a dedicated connection and calls onChange for every
+// rbac_changed notification until ctx is cancelled.
+func (repository *Repository) Listen(ctx context.Context, onChange func()) error {
+	conn, err := repository.db.Pool().Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire listen connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN rbac_changed"); err != nil {
+		return fmt.Errorf("failed to listen on rbac_changed: %w", err)
+	}
+
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// the connection may be broken, do not hand it back to the pool
+			conn.Conn().Close(context.Background())
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+		onChange()
+	}
+}
+
+// ensureExists reads the primary, the role or permission may have been
+// created by the previous request
+func (repository *Repository) ensureExists(ctx context.Context, role, permission string) error {
+	var roleExists, permissionExists bool
+	err := repository.db.QueryRow(db.WithReadYourWrites(ctx), `
+		SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1),
+			EXISTS (SELECT 1 FROM permissions WHERE name = $2)`,
+		role, permission,
+	).Scan(&roleExists, &permissionExists)
+	if err != nil {
+		return fmt.Errorf("failed to check role permission: %w", err)
+	}
+
+	if !roleExists {
+		return ErrRoleNotFound
+	}
+	if !permissionExists {
+		return ErrPermissionNotFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,223 @@
+package rbac
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go-template/middleware"
+)
+
+// Authorizer checks resource ownership inside services, where the owner is
+// only known after loading the resource.
+//
+// Example:
+//
+//	invoice, err := service.repository.GetByID(ctx, id)
+//	if err := service.authorizer.Authorize(ctx, "invoices:write", invoice.UserID); err != nil {
+//		return err
+//	}
+type Authorizer interface {
+	// Authorize allows the caller when they hold permission and own the
+	// resource, or hold permission + AnySuffix for resources of other users.
+	Authorize(ctx context.Context, permission, ownerID string) error
+}
+
+// Service caches role→permission mappings in memory. The cache is dropped
+// after every change made through the service, on rbac_changed notifications
+// (see Listen) and after cacheTTL as a safety net.
+type Service struct {
+	repository *Repository
+	cacheTTL   time.Duration
+
+	mu       sync.RWMutex
+	cache    map[string]map[string]struct{}
+	loadedAt time.Time
+	// generation is bumped by Invalidate, a load started before is not cached
+	generation uint64
+	loading    *cacheLoad
+}
+
+// cacheLoad is one reload shared by every request that missed the cache
+type cacheLoad struct {
+	generation uint64
+	done       chan struct{}
+	mappings   map[string]map[string]struct{}
+	err        error
+}
+
+// loadTimeout bounds a reload, it no longer ends with the request that started it
+const loadTimeout = 5 * time.Second
+
+func NewService(repository *Repository, cacheTTL time.Duration) *Service {
+	return &Service{repository: repository, cacheTTL: cacheTTL}
+}
+
+// HasPermission implements middleware.PermissionChecker
+func (service *Service) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+	permissions, err := service.rolePermissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	return matchPermission(permissions, permission), nil
+}
+
+func (service *Service) Authorize(ctx context.Context, permission, ownerID string) error {
+	claims := middleware.ClaimsFrom(ctx)
+	if claims == nil {
+		return ErrUnauthenticated
+	}
+
+	if claims.UserID != ownerID {
+		permission += AnySuffix
+	}
+
+	allowed, err := service.HasPermission(ctx, claims.Role, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Invalidate drops the cache, the next check reloads it from the database
+func (service *Service) Invalidate() {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.cache = nil
+	service.loading = nil
+	service.generation++
+}
+
+// Listen invalidates the cache whenever role_permissions changes on any
+// instance. It reconnects until ctx is cancelled, run it in a goroutine.
+func (service *Service) Listen(ctx context.Context) {
+	for {
+		err := service.repository.Listen(ctx, service.Invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("rbac listener stopped, retrying: %v", err)
+		service.Invalidate()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (service *Service) ListRoles(ctx context.Context) ([]Role, error) {
+	return service.repository.ListRoles(ctx)
+}
+
+func (service *Service) CreateRole(ctx context.Context, request CreateRoleRequest) (*Role, error) {
+	return service.repository.CreateRole(ctx, strings.TrimSpace(request.Name), request.Description)
+}
+
+func (service *Service) DeleteRole(ctx context.Context, name string) error {
+	defer service.Invalidate()
+	return service.repository.DeleteRole(ctx, name)
+}
+
+func (service *Service) ListPermissions(ctx context.Context) ([]Permission, error) {
+	return service.repository.ListPermissions(ctx)
+}
+
+func (service *Service) CreatePermission(ctx context.Context, request CreatePermissionRequest) (*Permission, error) {
+	return service.repository.CreatePermission(ctx, strings.TrimSpace(request.Name), request.Description)
+}
+
+func (service *Service) GrantPermission(ctx context.Context, role, permission string) error {
+	defer service.Invalidate()
+	return service.repository.GrantPermission(ctx, role, permission)
+}
+
+func (service *Service) RevokePermission(ctx context.Context, role, permission string) error {
+	defer service.Invalidate()
+	return service.repository.RevokePermission(ctx, role, permission)
+}
+
+func (service *Service) rolePermissions(ctx context.Context, role string) (map[string]struct{}, error) {
+	service.mu.RLock()
+	if service.cache != nil && time.Since(service.loadedAt) < service.cacheTTL {
+		permissions := service.cache[role]
+		service.mu.RUnlock()
+		return permissions, nil
+	}
+	service.mu.RUnlock()
+
+	load, leader := service.joinLoad()
+	if leader {
+		service.load(ctx, load)
+	}
+
+	select {
+	case <-load.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if load.err != nil {
+		return nil, load.err
+	}
+	return load.mappings[role], nil
+}
+
+// joinLoad returns the reload in flight, or a new one the caller has to run
+func (service *Service) joinLoad() (*cacheLoad, bool) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.loading != nil {
+		return service.loading, false
+	}
+	service.loading = &cacheLoad{generation: service.generation, done: make(chan struct{})}
+	return service.loading, true
+}
+
+// load queries without holding the lock and only takes it to swap the map.
+// The query is detached from the request so a cancelled leader does not fail
+// the requests waiting on it.
+func (service *Service) load(ctx context.Context, load *cacheLoad) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+	defer cancel()
+	load.mappings, load.err = service.repository.LoadRolePermissions(ctx)
+
+	service.mu.Lock()
+	if service.loading == load {
+		service.loading = nil
+	}
+	if load.err == nil && service.generation == load.generation {
+		service.cache = load.mappings
+		service.loadedAt = time.Now()
+	}
+	service.mu.Unlock()
+	close(load.done)
+}
+
+// matchPermission accepts exact matches and wildcards, e.g. "invoices:write"
+// is granted by "invoices:write", "invoices:*" or "*".
+func matchPermission(permissions map[string]struct{}, permission string) bool {
+	if _, ok := permissions[WildcardPermission]; ok {
+		return true
+	}
+	if _, ok := permissions[permission]; ok {
+		return true
+	}
+
+	for i := len(permission) - 1; i >= 0; i-- {
+		if permission[i] != ':' {
+			continue
+		}
+		if _, ok := permissions[permission[:i+1]+WildcardPermission]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -1 +1,85 @@
 package routes
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go-template/config"
+	"go-template/db"
+	"go-template/middleware"
+	"go-template/modules/auth"
+	module1 "go-template/modules/module_1"
+	"go-template/modules/outbox"
+	"go-template/modules/rbac"
+	"go-template/utils"
+)
+
+// NewRouter wires every module. Background work started here, such as the
+// rbac cache listener, the replica health checks and the email outbox
+// worker, stops when ctx is cancelled. It and work handlers leave behind,
+// like queueing a password reset email, is done once background.Wait
+// returns, wait for it after the server shut down and before closing the pools.
+func NewRouter(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) http.Handler {
+	router := utils.NewRouter()
+	router.Use(middleware.RequestID, middleware.Logger, middleware.Recover, middleware.Locale)
+
+	router.GET("/health", func(write http.ResponseWriter, request *http.Request) {
+		utils.Success(write, nil, "OK")
+	})
+
+	router.GET("/.well-known/jwks.json", utils.JWKSHandler)
+
+	api := router.Group("/api/v1", middleware.Timeout(cfg.HTTP.RequestTimeout))
+
+	// repositories share one handle so db.WithTx spans modules
+	database := db.New(cfg.DB, db.Options{
+		Replicas:            cfg.Replicas,
+		HealthCheckInterval: cfg.Database.ReplicaHealthCheckInterval,
+		Retry:               db.RetryPolicy{MaxAttempts: cfg.Database.TxMaxAttempts},
+	})
+	background.Go(func() { database.MonitorReplicas(ctx) })
+
+	// rbac
+	rbacRepository := rbac.NewRepository(database)
+	rbacService := rbac.NewService(rbacRepository, cfg.Auth.RBACCacheTTL)
+	rbacController := rbac.NewController(rbacService)
+	guard := middleware.NewGuard(rbacService)
+	rbacController.RegisterRoutes(api.Group("/rbac"), guard)
+	background.Go(func() { rbacService.Listen(ctx) })
+
+	// email outbox
+	outboxRepository := outbox.NewRepository(database)
+	outboxService := outbox.NewService(outboxRepository, outbox.Options{
+		MaxAttempts:   cfg.Mail.OutboxMaxAttempts,
+		RetryDelay:    cfg.Mail.OutboxRetryDelay,
+		MaxRetryDelay: cfg.Mail.OutboxMaxRetryDelay,
+		BatchSize:     cfg.Mail.OutboxBatchSize,
+		PollInterval:  cfg.Jobs.PollInterval,
+	})
+	outboxController := outbox.NewController(outboxService)
+	outboxController.RegisterRoutes(api.Group("/admin/outbox"), guard)
+	if cfg.Jobs.Enabled {
+		background.Go(func() { outboxService.Run(ctx) })
+	}
+
+	// auth
+	authRepository := auth.NewRepository(database)
+	authService := auth.NewService(authRepository, outboxService, auth.Options{
+		AppURL:           cfg.App.URL,
+		VerifyTokenTTL:   cfg.Auth.VerifyTokenTTL,
+		ResetPasswordURL: cfg.Auth.ResetPasswordURL,
+		ResetTokenTTL:    cfg.Auth.ResetTokenTTL,
+		Background:       background,
+	})
+	authController := auth.NewController(authService)
+	authController.RegisterRoutes(api.Group("/auth"))
+
+	// module 1
+	module1Repository := module1.NewRepository(database)
+	module1Service := module1.NewService(module1Repository)
+	module1Controller := module1.NewController(module1Service)
+	module1Controller.RegisterRoutes(api.Group("/module-1"))
+
+	return router
+}
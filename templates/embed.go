@@ -0,0 +1,23 @@
+package templates
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// files are compiled into the binary, so it renders mail from any working
+// directory. The *.fixtures.json files are only read by cmd/mailpreview.
+//
+//go:embed email/*.html email/*.txt email/layouts email/partials email/locales
+var files embed.FS
+
+// Email returns the email templates in dir, or the embedded ones when dir
+// is empty
+func Email(dir string) fs.FS {
+	if dir == "" {
+		email, _ := fs.Sub(files, "email")
+		return email
+	}
+	return os.DirFS(dir)
+}
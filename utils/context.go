@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+)
+
+type requestIDKey struct{}
+
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the X-Request-ID set by middleware.RequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+type localesKey struct{}
+
+func ContextWithLocales(ctx context.Context, locales []string) context.Context {
+	return context.WithValue(ctx, localesKey{}, locales)
+}
+
+// LocalesFromContext returns the Accept-Language preferences set by
+// middleware.Locale, most preferred first, or nil.
+func LocalesFromContext(ctx context.Context) []string {
+	locales, _ := ctx.Value(localesKey{}).([]string)
+	return locales
+}
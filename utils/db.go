@@ -4,37 +4,149 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectDB() (*pgxpool.Pool, error) {
-	dbuser := GetEnv("DB_USER", "")
-	dbpassword := GetEnv("DB_PASSWORD", "")
-	dbhost := GetEnv("DB_HOST", "")
-	dbport := GetEnv("DB_PORT", "")
-	dbname := GetEnv("DB_NAME", "")
-	dbsslmode := GetEnv("DB_SSL_MODE", "disable")
+// DBConfig uses URL when set, otherwise builds it from the discrete fields.
+// Zero pool settings keep the pgxpool defaults.
+type DBConfig struct {
+	URL      string
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+	SSLMode  string
 
-	if dbuser == "" || dbpassword == "" || dbhost == "" || dbport == "" || dbname == "" {
-		return nil, fmt.Errorf("DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, and DB_NAME must be set in environment variables")
+	MaxConns          int
+	MinConns          int
+	MaxConnIdleTime   time.Duration
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+	// StatementTimeout is sent as the statement_timeout runtime parameter
+	StatementTimeout time.Duration
+	// ConnectTimeout bounds the retries of the first ping, so the app can
+	// start while the database container is still booting
+	ConnectTimeout time.Duration
+
+	// SlowQueryThreshold and LogQueryArgs configure the QueryTracer
+	SlowQueryThreshold time.Duration
+	LogQueryArgs       bool
+}
+
+const (
+	initialPingBackoff = 250 * time.Millisecond
+	maxPingBackoff     = 5 * time.Second
+)
+
+// URLString escapes user, password and database name, so values such as
+// "p@ss/w%rd" do not break the URL
+func (config DBConfig) URLString() string {
+	if config.URL != "" {
+		return config.URL
 	}
 
-	databaseURL := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		dbuser, dbpassword, dbhost, dbport, dbname, dbsslmode,
-	)
+	databaseURL := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(config.User, config.Password),
+		Host:   net.JoinHostPort(config.Host, config.Port),
+		Path:   "/" + config.Name,
+	}
+	if config.SSLMode != "" {
+		databaseURL.RawQuery = url.Values{"sslmode": {config.SSLMode}}.Encode()
+	}
+	return databaseURL.String()
+}
 
-	pool, err := pgxpool.New(context.Background(), databaseURL)
+func ConnectDB(config DBConfig) (*pgxpool.Pool, error) {
+	pool, err := NewDBPool(config)
 	if err != nil {
-		return nil, fmt.Errorf("connection pool failed: %w", err)
+		return nil, err
 	}
 
-	err = pool.Ping(context.Background())
-	if err != nil {
+	if err := pingWithRetry(pool, config.ConnectTimeout); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("database connection failed: %w", err)
 	}
 
 	log.Println("Database connected successfully")
 	return pool, nil
 }
+
+// NewDBPool applies the settings without connecting, the pool dials on first
+// use. Replicas are opened this way so one that is down does not block startup.
+func NewDBPool(config DBConfig) (*pgxpool.Pool, error) {
+	if config.URL == "" && (config.User == "" || config.Password == "" || config.Host == "" || config.Port == "" || config.Name == "") {
+		return nil, fmt.Errorf("DATABASE_URL or DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, and DB_NAME must be set")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(config.URLString())
+	if err != nil {
+		// pgconn redacts the password in parse errors
+		return nil, fmt.Errorf("invalid database connection settings: %w", err)
+	}
+
+	if config.MaxConns > 0 {
+		poolConfig.MaxConns = int32(config.MaxConns)
+	}
+	if config.MinConns > 0 {
+		poolConfig.MinConns = int32(config.MinConns)
+	}
+	if config.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = config.MaxConnIdleTime
+	}
+	if config.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = config.MaxConnLifetime
+	}
+	if config.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = config.HealthCheckPeriod
+	}
+	if config.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+	}
+	poolConfig.ConnConfig.Tracer = &QueryTracer{
+		SlowThreshold: config.SlowQueryThreshold,
+		LogArgs:       config.LogQueryArgs,
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connection pool failed: %w", err)
+	}
+	return pool, nil
+}
+
+// pingWithRetry backs off exponentially until the deadline, a zero timeout pings once
+func pingWithRetry(pool *pgxpool.Pool, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	backoff := initialPingBackoff
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if timeout <= 0 {
+			return err
+		}
+
+		log.Printf("Database not ready (attempt %d), retrying in %s: %v", attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxPingBackoff)
+	}
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryStats counts the statements run with one request context, the access
+// log reports them so N+1 patterns stand out
+type QueryStats struct {
+	queries atomic.Int64
+	errors  atomic.Int64
+}
+
+func (stats *QueryStats) Queries() int64 {
+	return stats.queries.Load()
+}
+
+func (stats *QueryStats) Errors() int64 {
+	return stats.errors.Load()
+}
+
+type queryStatsKey struct{}
+
+// ContextWithQueryStats is called once per request by middleware.Logger
+func ContextWithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{}
+	return context.WithValue(ctx, queryStatsKey{}, stats), stats
+}
+
+// QueryStatsFromContext returns nil outside a request
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return stats
+}
+
+// QueryTracer counts every Query, QueryRow and Exec into the QueryStats of the
+// context and logs the statements slower than SlowThreshold
+type QueryTracer struct {
+	// SlowThreshold of zero disables the slow query log
+	SlowThreshold time.Duration
+	// LogArgs adds the arguments to the slow query log, see sanitizeArg
+	LogArgs bool
+}
+
+type traceKey struct{}
+
+type queryTrace struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+func (tracer *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceKey{}, queryTrace{start: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (tracer *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(traceKey{}).(queryTrace)
+	if !ok {
+		return
+	}
+
+	if stats := QueryStatsFromContext(ctx); stats != nil {
+		stats.queries.Add(1)
+		if data.Err != nil {
+			stats.errors.Add(1)
+		}
+	}
+
+	duration := time.Since(trace.start)
+	if tracer.SlowThreshold <= 0 || duration < tracer.SlowThreshold {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.Duration("duration", duration),
+		// one line per statement, the SQL literals in the modules span lines
+		slog.String("sql", strings.Join(strings.Fields(trace.sql), " ")),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+	if tracer.LogArgs {
+		args := make([]string, len(trace.args))
+		for i, arg := range trace.args {
+			args[i] = sanitizeArg(arg)
+		}
+		attrs = append(attrs, slog.Any("args", args))
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+
+	slog.LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+}
+
+// sanitizeArg keeps values that help debugging and cannot hold credentials or
+// personal data: numbers, booleans, times and UUIDs. Any other string, such as
+// an email or a password hash, is reduced to its length.
+func sanitizeArg(arg any) string {
+	switch value := arg.(type) {
+	case nil:
+		return "NULL"
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case *time.Time:
+		if value == nil {
+			return "NULL"
+		}
+		return value.Format(time.RFC3339Nano)
+	case string:
+		if isUUID(value) {
+			return value
+		}
+		return fmt.Sprintf("string(len=%d)", len(value))
+	case *string:
+		if value == nil {
+			return "NULL"
+		}
+		return sanitizeArg(*value)
+	case []byte:
+		return fmt.Sprintf("bytes(len=%d)", len(value))
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i, char := range value {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if char != '-' {
+				return false
+			}
+		case '0' <= char && char <= '9', 'a' <= char && char <= 'f', 'A' <= char && char <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
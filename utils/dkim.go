@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDKIMHeaders are signed when DKIMConfig.Headers is empty
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "To", "Cc", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+}
+
+type DKIMConfig struct {
+	// Domain is the d= tag, usually the domain of SMTP_FROM_EMAIL
+	Domain string
+	// Selector is the s= tag, the public key is published as a TXT record at
+	// <selector>._domainkey.<domain>
+	Selector string
+	// PrivateKeyPEM is an RSA or Ed25519 key
+	PrivateKeyPEM []byte
+	// Headers are signed when present, From always is
+	Headers []string
+}
+
+// DKIMMailer signs every mail with relaxed/relaxed canonicalization and
+// passes it on to the wrapped Mailer.
+//
+// Example:
+//
+//	mailer, err := utils.NewDKIMMailer(smtpMailer, utils.DKIMConfig{
+//		Domain:        "example.com",
+//		Selector:      "mail",
+//		PrivateKeyPEM: keyPEM,
+//	})
+type DKIMMailer struct {
+	next      Mailer
+	config    DKIMConfig
+	signer    crypto.Signer
+	algorithm string
+}
+
+func NewDKIMMailer(next Mailer, config DKIMConfig) (*DKIMMailer, error) {
+	if config.Domain == "" || config.Selector == "" {
+		return nil, fmt.Errorf("DKIM domain and selector are required")
+	}
+
+	signer, err := parsePrivateKeyPEM(config.PrivateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DKIM private key: %w", err)
+	}
+
+	var algorithm string
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %T", signer)
+	}
+
+	if len(config.Headers) == 0 {
+		config.Headers = DefaultDKIMHeaders
+	}
+	if !slices.ContainsFunc(config.Headers, func(name string) bool { return strings.EqualFold(name, "From") }) {
+		config.Headers = append([]string{"From"}, config.Headers...)
+	}
+
+	return &DKIMMailer{next: next, config: config, signer: signer, algorithm: algorithm}, nil
+}
+
+func (mailer *DKIMMailer) Send(ctx context.Context, mail Mail) error {
+	signed, err := mailer.Sign(mail.Data, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to sign mail: %w", err)
+	}
+	mail.Data = signed
+	return mailer.next.Send(ctx, mail)
+}
+
+// Close closes the wrapped Mailer, e.g. the reused SMTP connection
+func (mailer *DKIMMailer) Close() error {
+	if closer, ok := mailer.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Sign returns data with a DKIM-Signature header prepended
+func (mailer *DKIMMailer) Sign(data []byte, now time.Time) ([]byte, error) {
+	data = normalizeCRLF(data)
+
+	headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, fmt.Errorf("mail has no header and body separator")
+	}
+	fields := splitHeaderFields(data[:headerEnd+2])
+	body := data[headerEnd+4:]
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// the last instance of a repeated header is signed first, RFC 6376 5.4.2
+	var signedNames []string
+	var hashed bytes.Buffer
+	used := make(map[int]bool)
+	for _, name := range mailer.config.Headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fieldName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			signedNames = append(signedNames, strings.ToLower(name))
+			hashed.WriteString(relaxedHeader(fields[i]))
+			break
+		}
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + mailer.algorithm,
+		"c=relaxed/relaxed",
+		"d=" + mailer.config.Domain,
+		"s=" + mailer.config.Selector,
+		"t=" + strconv.FormatInt(now.Unix(), 10),
+		"h=" + strings.Join(signedNames, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	unsigned := "DKIM-Signature: " + strings.Join(tags, "; ")
+
+	// the signature header itself is hashed with an empty b= and no CRLF
+	hashed.WriteString(strings.TrimSuffix(relaxedHeader(unsigned+"\r\n"), "\r\n"))
+
+	signature, err := mailer.signHash(hashed.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var signed bytes.Buffer
+	// folding only adds whitespace that relaxed canonicalization removes again
+	signed.WriteString(strings.ReplaceAll(unsigned, "; ", ";\r\n\t"))
+	signed.WriteString(foldBase64(base64.StdEncoding.EncodeToString(signature)))
+	signed.WriteString("\r\n")
+	signed.Write(data)
+	return signed.Bytes(), nil
+}
+
+func (mailer *DKIMMailer) signHash(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	if mailer.algorithm == "ed25519-sha256" {
+		// RFC 8463 signs the SHA-256 digest with plain Ed25519
+		return mailer.signer.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	}
+	return mailer.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// relaxedHeader canonicalizes one header field including its CRLF, RFC 6376 3.4.2
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.TrimSpace(collapseWSP(value)) + "\r\n"
+}
+
+// relaxedBody canonicalizes the body, RFC 6376 3.4.4
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " \t")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWSP(value string) string {
+	var builder strings.Builder
+	space := false
+	for _, char := range value {
+		if char == ' ' || char == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteRune(char)
+	}
+	if space {
+		builder.WriteByte(' ')
+	}
+	return builder.String()
+}
+
+// splitHeaderFields keeps folded continuation lines with their field
+func splitHeaderFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimSpace(name)
+}
+
+// normalizeCRLF turns bare LF line endings into CRLF
+func normalizeCRLF(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) {
+		return data
+	}
+	normalized := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+}
+
+func foldBase64(value string) string {
+	var builder strings.Builder
+	for len(value) > 72 {
+		builder.WriteString(value[:72] + "\r\n\t")
+		value = value[72:]
+	}
+	builder.WriteString(value)
+	return builder.String()
+}
@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// RFC 6376 3.4.5
+	fields := splitHeaderFields([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n"))
+	var header strings.Builder
+	for _, field := range fields {
+		header.WriteString(relaxedHeader(field))
+	}
+	if got, want := header.String(), "a:X\r\nb:Y Z\r\n"; got != want {
+		t.Errorf("relaxed header = %q, want %q", got, want)
+	}
+
+	if got, want := string(relaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))), " C\r\nD E\r\n"; got != want {
+		t.Errorf("relaxed body = %q, want %q", got, want)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("relaxed empty body = %q, want empty", got)
+	}
+}
+
+func TestDKIMSignVerifies(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			mailer, publicKey := newTestDKIMMailer(t, keyType, nil)
+
+			signed, err := mailer.Sign(testDKIMMessage(t), time.Unix(1_700_000_000, 0))
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if err := verifyDKIM(signed, publicKey); err != nil {
+				t.Fatalf("signature does not verify: %v\n%s", err, signed)
+			}
+
+			// the signed message must still parse as mail
+			if _, err := mail.ReadMessage(bytes.NewReader(signed)); err != nil {
+				t.Fatalf("signed message does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestDKIMRelaxedToleratesWhitespace(t *testing.T) {
+	mailer, publicKey := newTestDKIMMailer(t, "rsa", nil)
+
+	signed, err := mailer.Sign(testDKIMMessage(t), time.Now())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// relays may refold headers and pad lines, relaxed canonicalization ignores that
+	modified := bytes.Replace(signed, []byte("Subject: Verify"), []byte("Subject:   Verify\r\n\t"), 1)
+	modified = append(modified, []byte("  \r\n\r\n")...)
+	if err := verifyDKIM(modified, publicKey); err != nil {
+		t.Fatalf("whitespace change broke the signature: %v", err)
+	}
+}
+
+func TestDKIMDetectsTampering(t *testing.T) {
+	mailer, publicKey := newTestDKIMMailer(t, "rsa", nil)
+
+	signed, err := mailer.Sign(testDKIMMessage(t), time.Now())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"subject": bytes.Replace(signed, []byte("Subject: Verify"), []byte("Subject: Verify now"), 1),
+		"from":    bytes.Replace(signed, []byte("noreply@example.com"), []byte("attacker@example.com"), 1),
+		// the body is quoted-printable, "=" is "=3D"
+		"body": bytes.Replace(signed, []byte("token=3Dabc"), []byte("token=3Dxyz"), 1),
+	}
+	for name, tampered := range tests {
+		if bytes.Equal(tampered, signed) {
+			t.Fatalf("%s: replacement did not change the message", name)
+		}
+		if err := verifyDKIM(tampered, publicKey); err == nil {
+			t.Errorf("%s: tampered message still verifies", name)
+		}
+	}
+}
+
+func TestDKIMSignsConfiguredHeaders(t *testing.T) {
+	mailer, publicKey := newTestDKIMMailer(t, "rsa", []string{"Subject"})
+
+	signed, err := mailer.Sign(testDKIMMessage(t), time.Now())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if tags := dkimTags(t, signed); tags["h"] != "from:subject" {
+		t.Errorf("h= %q, want from:subject since From is always signed", tags["h"])
+	}
+
+	// To is not signed, changing it keeps the signature valid
+	changed := bytes.Replace(signed, []byte("To: <user@example.com>"), []byte("To: <other@example.com>"), 1)
+	if err := verifyDKIM(changed, publicKey); err != nil {
+		t.Errorf("unsigned header change broke the signature: %v", err)
+	}
+}
+
+func TestDKIMMailerSignsBeforeSending(t *testing.T) {
+	memory := NewMemoryMailer()
+	keyPEM, publicKey := testDKIMKey(t, "ed25519")
+	mailer, err := NewDKIMMailer(memory, DKIMConfig{Domain: "example.com", Selector: "mail", PrivateKeyPEM: keyPEM})
+	if err != nil {
+		t.Fatalf("NewDKIMMailer: %v", err)
+	}
+
+	err = mailer.Send(context.Background(), Mail{From: "noreply@example.com", Recipients: []string{"user@example.com"}, Data: testDKIMMessage(t)})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	sent := memory.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(sent))
+	}
+	if err := verifyDKIM(sent[0].Data, publicKey); err != nil {
+		t.Fatalf("sent mail does not verify: %v", err)
+	}
+}
+
+func TestNewDKIMMailerRejectsBadConfig(t *testing.T) {
+	keyPEM, _ := testDKIMKey(t, "ed25519")
+	tests := map[string]DKIMConfig{
+		"no domain":   {Selector: "mail", PrivateKeyPEM: keyPEM},
+		"no selector": {Domain: "example.com", PrivateKeyPEM: keyPEM},
+		"bad key":     {Domain: "example.com", Selector: "mail", PrivateKeyPEM: []byte("not a key")},
+	}
+	for name, config := range tests {
+		if _, err := NewDKIMMailer(NewMemoryMailer(), config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func newTestDKIMMailer(t *testing.T, keyType string, headers []string) (*DKIMMailer, crypto.PublicKey) {
+	t.Helper()
+
+	keyPEM, publicKey := testDKIMKey(t, keyType)
+	mailer, err := NewDKIMMailer(NewMemoryMailer(), DKIMConfig{
+		Domain:        "example.com",
+		Selector:      "mail",
+		PrivateKeyPEM: keyPEM,
+		Headers:       headers,
+	})
+	if err != nil {
+		t.Fatalf("NewDKIMMailer: %v", err)
+	}
+	return mailer, publicKey
+}
+
+func testDKIMKey(t *testing.T, keyType string) ([]byte, crypto.PublicKey) {
+	t.Helper()
+
+	if keyType == "rsa" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		return keyPEM, &key.PublicKey
+	}
+
+	publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), publicKey
+}
+
+func testDKIMMessage(t *testing.T) []byte {
+	t.Helper()
+
+	message := Message{
+		From:    &mail.Address{Name: "Zoë from Example", Address: "noreply@example.com"},
+		To:      []string{"user@example.com"},
+		Subject: "Verify your account",
+		Text:    "Open http://localhost/verify?token=abc to verify.",
+		HTML:    `<p>Open <a href="http://localhost/verify?token=abc">this link</a> to verify.</p>`,
+	}
+	data, err := message.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	return data
+}
+
+// verifyDKIM checks the first DKIM-Signature the way a receiver does, with
+// the public key instead of a DNS lookup
+func verifyDKIM(message []byte, publicKey crypto.PublicKey) error {
+	headerEnd := bytes.Index(message, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return fmt.Errorf("no header and body separator")
+	}
+	fields := splitHeaderFields(message[:headerEnd+2])
+	body := message[headerEnd+4:]
+
+	signatureIndex := -1
+	for i, field := range fields {
+		if strings.EqualFold(fieldName(field), "DKIM-Signature") {
+			signatureIndex = i
+			break
+		}
+	}
+	if signatureIndex < 0 {
+		return fmt.Errorf("no DKIM-Signature")
+	}
+	tags := parseDKIMTags(fields[signatureIndex])
+
+	if tags["c"] != "relaxed/relaxed" {
+		return fmt.Errorf("c=%s, want relaxed/relaxed", tags["c"])
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return fmt.Errorf("body hash mismatch")
+	}
+
+	var hashed bytes.Buffer
+	used := map[int]bool{signatureIndex: true}
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), name) {
+				used[i] = true
+				hashed.WriteString(relaxedHeader(fields[i]))
+				break
+			}
+		}
+	}
+	emptied := emptySignatureValue.ReplaceAllString(fields[signatureIndex], "${1}")
+	hashed.WriteString(strings.TrimSuffix(relaxedHeader(emptied), "\r\n"))
+	digest := sha256.Sum256(hashed.Bytes())
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("invalid b=: %w", err)
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if tags["a"] != "rsa-sha256" {
+			return fmt.Errorf("a=%s for an RSA key", tags["a"])
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if tags["a"] != "ed25519-sha256" {
+			return fmt.Errorf("a=%s for an Ed25519 key", tags["a"])
+		}
+		if !ed25519.Verify(key, digest[:], signature) {
+			return fmt.Errorf("ed25519 verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key %T", publicKey)
+	}
+}
+
+// emptySignatureValue matches the b= tag, not bh=, keeping "b=" itself
+var emptySignatureValue = regexp.MustCompile(`((?:^|;)\s*b\s*=)[^;]*`)
+
+func parseDKIMTags(field string) map[string]string {
+	_, value, _ := strings.Cut(field, ":")
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(value, ";") {
+		name, tagValue, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(tagValue), "")
+	}
+	return tags
+}
+
+func dkimTags(t *testing.T, message []byte) map[string]string {
+	t.Helper()
+
+	headerEnd := bytes.Index(message, []byte("\r\n\r\n"))
+	for _, field := range splitHeaderFields(message[:headerEnd+2]) {
+		if fieldName(field) == "DKIM-Signature" {
+			return parseDKIMTags(field)
+		}
+	}
+	t.Fatal("no DKIM-Signature")
+	return nil
+}
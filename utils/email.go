@@ -1,150 +1,169 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"html/template"
-	"log"
-	"net/smtp"
+	"io"
+	"net/mail"
 	"strings"
 	"sync"
 )
 
 type EmailConfig struct {
-	SMTPHost     string
-	SMTPPort     string
-	SMTPUsername string
-	SMTPPassword string
-	FromEmail    string
-	FromName     string
+	FromEmail string
+	FromName  string
 }
 
 var (
-	emailConfig     *EmailConfig
-	emailConfigOnce sync.Once
-	emailInitErr    error
+	emailConfig    *EmailConfig
+	emailMailer    Mailer
+	emailTemplates *EmailTemplates
+	emailConfigMu  sync.RWMutex
 )
 
-func getEmailConfig() (*EmailConfig, error) {
-	emailConfigOnce.Do(func() {
-		host := GetEnv("SMTP_HOST", "")
-		port := GetEnv("SMTP_PORT", "587")
-		username := GetEnv("SMTP_USERNAME", "")
-		password := GetEnv("SMTP_PASSWORD", "")
-		fromEmail := GetEnv("SMTP_FROM_EMAIL", "")
-		fromName := GetEnv("SMTP_FROM_NAME", "No Reply")
-
-		if host == "" || username == "" || password == "" || fromEmail == "" {
-			emailInitErr = fmt.Errorf("SMTP_HOST, SMTP_USERNAME, SMTP_PASSWORD, and SMTP_FROM_EMAIL must be set")
-			return
-		}
+// InitEmail sets the sender, the transport and the parsed templates, called
+// from config.InitConfig
+func InitEmail(config EmailConfig, mailer Mailer, templates *EmailTemplates) {
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
 
-		emailConfig = &EmailConfig{
-			SMTPHost:     host,
-			SMTPPort:     port,
-			SMTPUsername: username,
-			SMTPPassword: password,
-			FromEmail:    fromEmail,
-			FromName:     fromName,
-		}
+	emailConfig = &config
+	emailMailer = mailer
+	emailTemplates = templates
+}
 
-		log.Println("Email config initialized successfully")
-	})
+// CloseEmail releases the transport, e.g. the reused SMTP connection
+func CloseEmail() error {
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
 
-	if emailInitErr != nil {
-		return nil, emailInitErr
+	if closer, ok := emailMailer.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
+}
 
-	return emailConfig, nil
+func getEmailConfig() (*EmailConfig, Mailer, *EmailTemplates, error) {
+	emailConfigMu.RLock()
+	defer emailConfigMu.RUnlock()
+
+	if emailConfig == nil || emailMailer == nil || emailTemplates == nil {
+		return nil, nil, nil, fmt.Errorf("email is not initialized, call utils.InitEmail first")
+	}
+	return emailConfig, emailMailer, emailTemplates, nil
 }
 
-func SendEmail(to, subject, templatePath string, data interface{}) error {
-	config, err := getEmailConfig()
+// RenderEmail renders the subject, HTML and plain text bodies of a template
+// in the supported locale best matching locale, empty is the default locale
+func RenderEmail(templateName, locale string, data interface{}) (*RenderedEmail, error) {
+	_, _, templates, err := getEmailConfig()
 	if err != nil {
-		return fmt.Errorf("failed to get email config: %w", err)
+		return nil, fmt.Errorf("failed to get email config: %w", err)
 	}
+	return templates.Render(templateName, locale, data)
+}
 
-	recipients := parseEmails(to)
-	if len(recipients) == 0 {
-		return fmt.Errorf("no valid recipients provided")
+// TranslateEmail returns key from the email catalog of locale, falling back
+// to the default locale, e.g. for strings formatted before rendering
+func TranslateEmail(locale, key string) (string, error) {
+	_, _, templates, err := getEmailConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to get email config: %w", err)
 	}
+	locale, _ = templates.MatchLocale(locale)
+	return templates.translate(locale, key)
+}
 
-	tmpl, err := template.ParseFiles(templatePath)
+// EmailLocales returns the locales with an email catalog
+func EmailLocales() []string {
+	_, _, templates, err := getEmailConfig()
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return nil
 	}
+	return templates.Locales()
+}
 
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+// MatchEmailLocale returns the first supported email locale of preferences,
+// see EmailTemplates.MatchLocale. It returns "", false before InitEmail.
+func MatchEmailLocale(preferences ...string) (string, bool) {
+	_, _, templates, err := getEmailConfig()
+	if err != nil {
+		return "", false
 	}
+	return templates.MatchLocale(preferences...)
+}
 
-	from := fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail)
-	message := "From: " + from + "\r\n"
-	message += "To: " + strings.Join(recipients, ", ") + "\r\n"
-	message += "Subject: " + subject + "\r\n"
-	message += "MIME-Version: 1.0\r\n"
-	message += "Content-Type: text/html; charset=UTF-8\r\n"
-	message += "\r\n"
-	message += body.String()
-
-	auth := smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
-	addr := fmt.Sprintf("%s:%s", config.SMTPHost, config.SMTPPort)
-
-	if err := smtp.SendMail(addr, auth, config.FromEmail, recipients, []byte(message)); err != nil {
-		return fmt.Errorf("failed to send email (to=%s, subject=%s): %w", to, subject, err)
+// SendMessage sends a Message, From defaults to the configured sender
+func SendMessage(ctx context.Context, message Message) error {
+	mail, err := BuildMail(message)
+	if err != nil {
+		return err
+	}
+	if err := DeliverMail(ctx, mail); err != nil {
+		return fmt.Errorf("failed to send email (to=%s, subject=%s): %w",
+			strings.Join(message.To, ", "), message.Subject, err)
 	}
-
 	return nil
 }
 
-func SendEmailWithCC(to, cc, subject, templatePath string, data interface{}) error {
-	config, err := getEmailConfig()
+// BuildMail encodes a Message for a later DeliverMail, e.g. from the outbox
+func BuildMail(message Message) (Mail, error) {
+	config, _, _, err := getEmailConfig()
 	if err != nil {
-		return fmt.Errorf("failed to get email config: %w", err)
+		return Mail{}, fmt.Errorf("failed to get email config: %w", err)
 	}
 
-	toRecipients := parseEmails(to)
-	ccRecipients := parseEmails(cc)
-
-	if len(toRecipients) == 0 {
-		return fmt.Errorf("no valid recipients provided")
+	if message.From == nil {
+		message.From = &mail.Address{Name: config.FromName, Address: config.FromEmail}
 	}
 
-	tmpl, err := template.ParseFiles(templatePath)
+	recipients, err := message.Recipients()
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return Mail{}, fmt.Errorf("failed to build email: %w", err)
 	}
-
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	data, err := message.Bytes()
+	if err != nil {
+		return Mail{}, fmt.Errorf("failed to build email: %w", err)
 	}
+	return Mail{From: message.From.Address, Recipients: recipients, Data: data}, nil
+}
 
-	from := fmt.Sprintf("%s <%s>", config.FromName, config.FromEmail)
-	message := "From: " + from + "\r\n"
-	message += "To: " + strings.Join(toRecipients, ", ") + "\r\n"
-
-	if len(ccRecipients) > 0 {
-		message += "Cc: " + strings.Join(ccRecipients, ", ") + "\r\n"
+// DeliverMail hands an encoded mail to the configured transport
+func DeliverMail(ctx context.Context, mail Mail) error {
+	_, mailer, _, err := getEmailConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get email config: %w", err)
 	}
+	return mailer.Send(ctx, mail)
+}
 
-	message += "Subject: " + subject + "\r\n"
-	message += "MIME-Version: 1.0\r\n"
-	message += "Content-Type: text/html; charset=UTF-8\r\n"
-	message += "\r\n"
-	message += body.String()
-
-	allRecipients := append(toRecipients, ccRecipients...)
+func SendEmail(to, subject, templateName string, data interface{}) error {
+	return SendEmailWithCC(to, "", subject, templateName, data)
+}
 
-	auth := smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
-	addr := fmt.Sprintf("%s:%s", config.SMTPHost, config.SMTPPort)
+// SendEmailWithCC renders in the default locale, an empty subject is taken
+// from the catalog. EmailTemplate.Send takes the locale of the recipient.
+func SendEmailWithCC(to, cc, subject, templateName string, data interface{}) error {
+	recipients := parseEmails(to)
+	if len(recipients) == 0 {
+		return fmt.Errorf("no valid recipients provided")
+	}
 
-	if err := smtp.SendMail(addr, auth, config.FromEmail, allRecipients, []byte(message)); err != nil {
-		return fmt.Errorf("failed to send email (to=%s, cc=%s, subject=%s): %w", to, cc, subject, err)
+	rendered, err := RenderEmail(templateName, "", data)
+	if err != nil {
+		return err
+	}
+	if subject == "" {
+		subject = rendered.Subject
 	}
 
-	return nil
+	return SendMessage(context.Background(), Message{
+		To:      recipients,
+		Cc:      parseEmails(cc),
+		Subject: subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	})
 }
 
 func parseEmails(emails string) []string {
@@ -173,7 +192,9 @@ type VerifyEmailData struct {
     ExpiredTime string
 }
 
-// Usage using template/email/verify.html
+// Usage using templates/email/verify.en.html, the name is the file name
+// without the locale and .html, the subject may be "" to use verify.subject
+// from templates/email/locales/en.json
 func SendVerificationEmail(userEmail, userName, token string) error {
     // Create the struct
     data := VerifyEmailData{
@@ -186,7 +207,7 @@ func SendVerificationEmail(userEmail, userName, token string) error {
     return utils.SendEmail(
         userEmail,
         "Verify Your Account",
-        "templates/emails/verify.html",
+        "verify",
         data,
     )
 
@@ -195,27 +216,25 @@ func SendVerificationEmail(userEmail, userName, token string) error {
 	    userEmail,
         "admin@example.com,support@example.com",
         "Verify Your Account",
-        "templates/emails/verify.html",
+        "verify",
         data,
 	)
 }
 */
 
 /* ANOTHER Example:
-// Adding new email template in templates/email called annoucement.html
-<!DOCTYPE html>
-<html>
-<head>
-<meta charset="UTF-8">
-<title>Announcement</title>
-</head>
-<body>
+// Adding new email template in templates/email called announcement.en.html,
+// plus announcement.id.html for Indonesian, layouts/base.html wraps the
+// content and adds the footer. Subjects go in templates/email/locales/*.json:
+//   "announcement.subject": "Important Announcement"
+{{template "layout" .}}
+
+{{define "content"}}
 <h2>Hello {{.TeamName}},</h2>
 <p>We are excited to announce: <b>{{.Message}}</b></p>
 <p>Date: {{.Date}}</p>
 <p>regards, Admin Team</p>
-</body>
-</html>
+{{end}}
 
 // Usage
 type AnnouncementData struct {
@@ -228,7 +247,7 @@ err := utils.SendEmailWithCC(
 	"user1@example.com,user2@example.com,user3@example.com",
 	"manager@example.com,hr@example.com",
 	"Important Announcement",
-	"templates/emails/announcement.html",
+	"announcement",
 	AnnouncementData{
 		TeamName: "Development Team",
 		Message:  "Version 2.0 Release",
@@ -240,4 +259,11 @@ if err != nil {
 } else {
 	log.Println("announcement email sent successfully")
 }
+
+// Or typed, in the language of the user, falling back to the Accept-Language
+// header of the request and then to MAIL_DEFAULT_LOCALE
+var announcementEmail = utils.NewEmailTemplate[AnnouncementData]("announcement")
+
+locale, _ := utils.MatchEmailLocale(append([]string{user.Locale}, utils.LocalesFromContext(ctx)...)...)
+err := announcementEmail.Send(user.Email, locale, data)
 */
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is an email before encoding. Text and HTML become a
+// multipart/alternative body when both are set, attachments with a ContentID
+// are inline parts the HTML refers to as cid:<ContentID>.
+//
+// Example:
+//
+//	message := utils.Message{
+//		To:      []string{"user@example.com"},
+//		Bcc:     []string{"audit@example.com"},
+//		ReplyTo: []string{"support@example.com"},
+//		Subject: "Your invoice",
+//		Text:    "Your invoice is attached.",
+//		HTML:    `<img src="cid:logo"><p>Your invoice is attached.</p>`,
+//	}
+//	message.Embed("logo", "logo.png", logo)
+//	message.Attach("invoice.pdf", invoice)
+//	err := utils.SendMessage(ctx, message)
+type Message struct {
+	// From defaults to SMTP_FROM_NAME <SMTP_FROM_EMAIL>
+	From        *mail.Address
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename string
+	// ContentType defaults to the type of the Filename extension
+	ContentType string
+	// ContentID makes the attachment inline
+	ContentID string
+	Data      []byte
+}
+
+func (message *Message) Attach(filename string, data []byte) {
+	message.Attachments = append(message.Attachments, Attachment{Filename: filename, Data: data})
+}
+
+func (message *Message) Embed(contentID, filename string, data []byte) {
+	message.Attachments = append(message.Attachments, Attachment{Filename: filename, ContentID: contentID, Data: data})
+}
+
+// Recipients is the SMTP envelope, To, Cc and Bcc. An address that does not
+// parse is an error rather than a recipient quietly left out.
+func (message *Message) Recipients() ([]string, error) {
+	recipients := make([]string, 0, len(message.To)+len(message.Cc)+len(message.Bcc))
+	for _, list := range []struct {
+		name      string
+		addresses []string
+	}{
+		{"To", message.To},
+		{"Cc", message.Cc},
+		{"Bcc", message.Bcc},
+	} {
+		for _, address := range list.addresses {
+			parsed, err := mail.ParseAddress(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", list.name, address, err)
+			}
+			recipients = append(recipients, parsed.Address)
+		}
+	}
+	return recipients, nil
+}
+
+// Bytes encodes the message as RFC 5322 with MIME parts, Bcc is left out of
+// the headers
+func (message *Message) Bytes() ([]byte, error) {
+	if message.From == nil {
+		return nil, fmt.Errorf("message has no sender")
+	}
+	// parses Bcc as well, which never reaches the headers below
+	recipients, err := message.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients provided")
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", message.From.String())
+
+	for _, header := range []struct {
+		name      string
+		addresses []string
+	}{
+		{"To", message.To},
+		{"Cc", message.Cc},
+		{"Reply-To", message.ReplyTo},
+	} {
+		if len(header.addresses) == 0 {
+			continue
+		}
+		value, err := formatAddressList(header.addresses)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", header.name, err)
+		}
+		writeHeader(&buf, header.name, value)
+	}
+
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", newMessageID(message.From.Address))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	if err := message.writeBody(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody nests the parts as mixed(related(alternative(text, html), inline), attachments),
+// leaving out every level that has a single part
+func (message *Message) writeBody(buf *bytes.Buffer) error {
+	var inline, attached []Attachment
+	for _, attachment := range message.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+
+	body := message.alternative()
+	if len(inline) > 0 {
+		body = related(body, inline)
+	}
+	if len(attached) > 0 {
+		body = mixed(body, attached)
+	}
+
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if value := body.header.Get(key); value != "" {
+			writeHeader(buf, key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	return body.write(buf)
+}
+
+// mimePart is a header and a function writing the encoded content
+type mimePart struct {
+	header textproto.MIMEHeader
+	write  func(io.Writer) error
+}
+
+func (message *Message) alternative() mimePart {
+	switch {
+	case message.HTML == "":
+		return textPart("text/plain", message.Text)
+	case message.Text == "":
+		return textPart("text/html", message.HTML)
+	}
+	// clients show the last part they understand, HTML goes last
+	return multipartOf("alternative", textPart("text/plain", message.Text), textPart("text/html", message.HTML))
+}
+
+func related(body mimePart, inline []Attachment) mimePart {
+	parts := []mimePart{body}
+	for _, attachment := range inline {
+		parts = append(parts, attachmentPart(attachment, "inline"))
+	}
+	return multipartOf("related", parts...)
+}
+
+func mixed(body mimePart, attached []Attachment) mimePart {
+	parts := []mimePart{body}
+	for _, attachment := range attached {
+		parts = append(parts, attachmentPart(attachment, "attachment"))
+	}
+	return multipartOf("mixed", parts...)
+}
+
+func textPart(contentType, content string) mimePart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	return mimePart{header: header, write: func(w io.Writer) error {
+		writer := quotedprintable.NewWriter(w)
+		if _, err := writer.Write([]byte(content)); err != nil {
+			return err
+		}
+		return writer.Close()
+	}}
+}
+
+func attachmentPart(attachment Attachment, disposition string) mimePart {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+
+	return mimePart{header: header, write: func(w io.Writer) error {
+		return writeBase64(w, attachment.Data)
+	}}
+}
+
+func multipartOf(subtype string, parts ...mimePart) mimePart {
+	boundary := "b" + GenerateRandomString(24)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+
+	return mimePart{header: header, write: func(w io.Writer) error {
+		writer := multipart.NewWriter(w)
+		if err := writer.SetBoundary(boundary); err != nil {
+			return err
+		}
+		for _, part := range parts {
+			partWriter, err := writer.CreatePart(part.header)
+			if err != nil {
+				return err
+			}
+			if err := part.write(partWriter); err != nil {
+				return err
+			}
+		}
+		return writer.Close()
+	}}
+}
+
+// writeBase64 wraps lines at 76 characters as RFC 2045 requires
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	// a value must not end the header block early
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// formatAddressList encodes non-ASCII display names per RFC 2047
+func formatAddressList(addresses []string) (string, error) {
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return "", fmt.Errorf("%q: %w", address, err)
+		}
+		formatted[i] = parsed.String()
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), GenerateRandomString(12), domain)
+}
@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// EmailTemplates holds every email parsed once at startup, per locale.
+//
+//	verify.en.html         the "verify" email in English
+//	verify.id.html         the same in Indonesian
+//	verify.en.txt          optional plain text alternative of verify.en.html
+//	announcement.html      no locale, used for every locale without its own file
+//	layouts/*.html         shared "layout" and other definitions
+//	partials/*.html
+//	locales/en.json        message catalog, one per supported locale
+//
+// The catalog holds the subject of each email as "<name>.subject" and the
+// strings templates translate with {{t "key"}}, {{locale}} is the locale the
+// email is rendered in. A locale resolves to itself, its base language
+// ("id" for "id-ID") and then the default locale.
+//
+// Example, templates/email/announcement.en.html:
+//
+//	{{template "layout" .}}
+//
+//	{{define "content"}}
+//	    <h2>Hello {{.TeamName}},</h2>
+//	    <p>We are excited to announce: <b>{{.Message}}</b></p>
+//	{{end}}
+type EmailTemplates struct {
+	defaultLocale string
+	// locales are the catalogs found, sorted
+	locales  []string
+	catalogs map[string]map[string]string
+	// templates and texts are keyed by name, then by supported locale
+	templates map[string]map[string]*template.Template
+	texts     map[string]map[string]*texttemplate.Template
+}
+
+// RenderedEmail is one email in the locale it was resolved to
+type RenderedEmail struct {
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// emailPage is one template file, locale is empty for files without one
+type emailPage struct {
+	file   string
+	locale string
+}
+
+// LoadEmailTemplates parses fsys and reports every broken file at once
+func LoadEmailTemplates(fsys fs.FS, defaultLocale string) (*EmailTemplates, error) {
+	templates := &EmailTemplates{
+		defaultLocale: defaultLocale,
+		catalogs:      make(map[string]map[string]string),
+		templates:     make(map[string]map[string]*template.Template),
+		texts:         make(map[string]map[string]*texttemplate.Template),
+	}
+
+	if err := templates.loadCatalogs(fsys); err != nil {
+		return nil, err
+	}
+
+	shared, err := fs.Glob(fsys, "layouts/*.html")
+	if err != nil {
+		return nil, err
+	}
+	partials, err := fs.Glob(fsys, "partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	shared = append(shared, partials...)
+
+	// t and locale are bound per locale below, they only have to exist to parse
+	base := template.New("").Funcs(templates.funcs(defaultLocale))
+	if len(shared) > 0 {
+		if base, err = base.ParseFS(fsys, shared...); err != nil {
+			return nil, fmt.Errorf("failed to parse email layouts: %w", err)
+		}
+	}
+
+	htmlPages, err := templates.pages(fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	textPages, err := templates.pages(fsys, "*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for name, pages := range htmlPages {
+		templates.templates[name] = make(map[string]*template.Template)
+		templates.texts[name] = make(map[string]*texttemplate.Template)
+
+		for _, locale := range templates.locales {
+			page, ok := templates.pageFor(pages, locale)
+			if !ok {
+				errs = append(errs, fmt.Errorf("email template %s: no file for locale %s or %s", name, locale, defaultLocale))
+				continue
+			}
+
+			// every page defines its own "content", so each gets a copy of the layouts
+			tmpl, err := base.Clone()
+			if err == nil {
+				tmpl, err = tmpl.Funcs(templates.funcs(locale)).ParseFS(fsys, page.file)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("email template %s: %w", page.file, err))
+				continue
+			}
+			templates.templates[name][locale] = tmpl.Lookup(page.file)
+
+			// the text alternative has to be in the language of the HTML page
+			for _, text := range textPages[name] {
+				if text.locale != page.locale {
+					continue
+				}
+				textTmpl, err := texttemplate.New(text.file).Funcs(texttemplate.FuncMap(templates.funcs(locale))).ParseFS(fsys, text.file)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("email template %s: %w", text.file, err))
+					continue
+				}
+				templates.texts[name][locale] = textTmpl
+			}
+		}
+	}
+	for name, pages := range textPages {
+		if _, ok := htmlPages[name]; !ok {
+			errs = append(errs, fmt.Errorf("email template %s: no %s html file next to it", pages[0].file, name))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// loadCatalogs reads locales/*.json, without any the default locale is the
+// only one and has an empty catalog
+func (templates *EmailTemplates) loadCatalogs(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			errs = append(errs, fmt.Errorf("email catalog %s: %w", file, err))
+			continue
+		}
+		templates.catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if len(templates.catalogs) == 0 {
+		templates.catalogs[templates.defaultLocale] = map[string]string{}
+	}
+	if _, ok := templates.catalogs[templates.defaultLocale]; !ok {
+		return fmt.Errorf("no email catalog locales/%s.json for the default locale", templates.defaultLocale)
+	}
+
+	for locale := range templates.catalogs {
+		templates.locales = append(templates.locales, locale)
+	}
+	sort.Strings(templates.locales)
+	return nil
+}
+
+// pages groups the files matching pattern by email name, "verify.id.html" is
+// the "id" page of "verify"
+func (templates *EmailTemplates) pages(fsys fs.FS, pattern string) (map[string][]emailPage, error) {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string][]emailPage)
+	for _, file := range files {
+		name := strings.TrimSuffix(file, path.Ext(file))
+		locale := ""
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			name, locale = name[:dot], name[dot+1:]
+			if _, ok := templates.catalogs[locale]; !ok {
+				return nil, fmt.Errorf("email template %s: no catalog locales/%s.json", file, locale)
+			}
+		}
+		pages[name] = append(pages[name], emailPage{file: file, locale: locale})
+	}
+	return pages, nil
+}
+
+// pageFor picks the file of locale, else the one without a locale, else the
+// one of the default locale
+func (templates *EmailTemplates) pageFor(pages []emailPage, locale string) (emailPage, bool) {
+	for _, want := range []string{locale, "", templates.defaultLocale} {
+		for _, page := range pages {
+			if page.locale == want {
+				return page, true
+			}
+		}
+	}
+	return emailPage{}, false
+}
+
+func (templates *EmailTemplates) funcs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string) (string, error) {
+			return templates.translate(locale, key)
+		},
+		"locale": func() string {
+			return locale
+		},
+	}
+}
+
+// translate falls back to the default locale catalog, a key missing from
+// both fails the render
+func (templates *EmailTemplates) translate(locale, key string) (string, error) {
+	for _, catalogLocale := range []string{locale, templates.defaultLocale} {
+		if message, ok := templates.catalogs[catalogLocale][key]; ok {
+			return message, nil
+		}
+	}
+	return "", fmt.Errorf("no %q in email catalog %s or %s", key, locale, templates.defaultLocale)
+}
+
+// Locales returns the supported locales, one per catalog
+func (templates *EmailTemplates) Locales() []string {
+	return slices.Clone(templates.locales)
+}
+
+// MatchLocale returns the first supported locale of preferences, tried as
+// given and by base language, e.g. "id" for "id-ID". ok is false when none
+// matched and the default locale is returned.
+func (templates *EmailTemplates) MatchLocale(preferences ...string) (string, bool) {
+	for _, preference := range preferences {
+		preference = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(preference), "_", "-"))
+		if preference == "" {
+			continue
+		}
+		if _, ok := templates.catalogs[preference]; ok {
+			return preference, true
+		}
+		language, _, _ := strings.Cut(preference, "-")
+		if _, ok := templates.catalogs[language]; ok {
+			return language, true
+		}
+	}
+	return templates.defaultLocale, false
+}
+
+// Render renders name in the locale best matching locale, an empty locale is
+// the default one. Text is empty when the page has no .txt alternative.
+func (templates *EmailTemplates) Render(name, locale string, data any) (*RenderedEmail, error) {
+	locale, _ = templates.MatchLocale(locale)
+
+	tmpl, ok := templates.templates[name][locale]
+	if !ok {
+		return nil, fmt.Errorf("email template %q does not exist", name)
+	}
+
+	subject, err := templates.translate(locale, name+".subject")
+	if err != nil {
+		return nil, fmt.Errorf("email template %s: %w", name, err)
+	}
+
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s (%s): %w", name, locale, err)
+	}
+
+	var text bytes.Buffer
+	if textTmpl, ok := templates.texts[name][locale]; ok {
+		if err := textTmpl.Execute(&text, data); err != nil {
+			return nil, fmt.Errorf("failed to render email template %s (%s) text: %w", name, locale, err)
+		}
+	}
+
+	return &RenderedEmail{Locale: locale, Subject: subject, HTML: html.String(), Text: text.String()}, nil
+}
+
+// Names returns the template names, sorted, e.g. "verify" for verify.en.html
+func (templates *EmailTemplates) Names() []string {
+	names := make([]string, 0, len(templates.templates))
+	for name := range templates.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check renders every template declared with NewEmailTemplate in every
+// locale with a zero value of its data type, so a missing file, subject or
+// field fails at startup instead of at send time
+func (templates *EmailTemplates) Check() error {
+	declaredMu.Lock()
+	defer declaredMu.Unlock()
+
+	var errs []error
+	for _, declared := range declaredTemplates {
+		for _, locale := range templates.locales {
+			if _, err := templates.Render(declared.name, locale, declared.sample); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	declaredTemplates []declaredTemplate
+	declaredMu        sync.Mutex
+)
+
+type declaredTemplate struct {
+	name   string
+	sample any
+}
+
+// EmailTemplate ties a template name to the data type it renders.
+//
+// Example:
+//
+//	var announcementEmail = utils.NewEmailTemplate[AnnouncementData]("announcement")
+//
+//	err := announcementEmail.Send("team@example.com", user.Locale, AnnouncementData{
+//		TeamName: "Development Team",
+//		Message:  "Version 2.0 Release",
+//	})
+type EmailTemplate[T any] struct {
+	Name string
+}
+
+// NewEmailTemplate is meant for package level vars, Check then covers the
+// template before the first send
+func NewEmailTemplate[T any](name string) EmailTemplate[T] {
+	declaredMu.Lock()
+	defer declaredMu.Unlock()
+
+	var sample T
+	declaredTemplates = append(declaredTemplates, declaredTemplate{name: name, sample: sample})
+	return EmailTemplate[T]{Name: name}
+}
+
+// Message renders the email with the subject of the catalog, for adding
+// recipients, attachments or a Reply-To before SendMessage
+func (email EmailTemplate[T]) Message(locale string, data T) (Message, error) {
+	rendered, err := RenderEmail(email.Name, locale, data)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: rendered.Subject, HTML: rendered.HTML, Text: rendered.Text}, nil
+}
+
+func (email EmailTemplate[T]) Send(to, locale string, data T) error {
+	message, err := email.Message(locale, data)
+	if err != nil {
+		return err
+	}
+	message.To = parseEmails(to)
+	return SendMessage(context.Background(), message)
+}
+
+func (email EmailTemplate[T]) SendWithCC(to, cc, locale string, data T) error {
+	message, err := email.Message(locale, data)
+	if err != nil {
+		return err
+	}
+	message.To = parseEmails(to)
+	message.Cc = parseEmails(cc)
+	return SendMessage(context.Background(), message)
+}
@@ -1,75 +1,250 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const minJWTSecretLength = 32
+
+// insecureJWTSecrets are public values that must never sign production tokens
+var insecureJWTSecrets = []string{
+	"default-access-secret",
+	"default-refresh-secret",
+	"supersecureaccesskey",
+	"supersecurerefreshkey",
+}
+
+type JWTConfig struct {
+	// Algorithm is HS256, RS256 or EdDSA. RS256 and EdDSA sign access tokens
+	// with PrivateKeyPath so other services can verify them through the JWKS
+	// endpoint, refresh tokens are only read by this service and stay on
+	// HS256 with RefreshSecret.
+	Algorithm      string
+	PrivateKeyPath string
+	KeyID          string
+	// VerifyKeyPaths lists "kid=path" or "path" entries of previous keys
+	VerifyKeyPaths []string
+	AccessSecret   []byte
+	RefreshSecret  []byte
+	AccessTTL      time.Duration
+	RefreshTTL     time.Duration
+	Issuer         string
+	Audience       []string
+}
+
 var (
-	jwtAccessSecret  []byte
-	jwtRefreshSecret []byte
-	accessTokenTTL   int
-	refreshTokenTTL  int
+	jwtConfig     JWTConfig
+	accessSigner  *JWTSigner
+	refreshSigner *JWTSigner
+	jwtMu         sync.RWMutex
 )
 
-func init() {
-	jwtAccessSecret = GetEnvBytes("JWT_ACCESS_SECRET", "default-access-secret")
-	jwtRefreshSecret = GetEnvBytes("JWT_REFRESH_SECRET", "default-refresh-secret")
-	accessTokenTTL = GetEnvInt("JWT_ACCESS_TTL_MINUTES", 15)
-	refreshTokenTTL = GetEnvInt("JWT_REFRESH_TTL_DAYS", 7)
+// Validate reports every problem at once. Development accepts short and well
+// known secrets, any other environment refuses them.
+func (config JWTConfig) Validate(appEnv string) error {
+	var errs []error
+	development := appEnv == "development"
+
+	checkSecret := func(name string, secret []byte) {
+		switch {
+		case len(secret) == 0:
+			errs = append(errs, fmt.Errorf("%s must be set", name))
+		case development:
+		case slices.Contains(insecureJWTSecrets, string(secret)):
+			errs = append(errs, fmt.Errorf("%s uses a well known default value", name))
+		case len(secret) < minJWTSecretLength:
+			errs = append(errs, fmt.Errorf("%s must be at least %d bytes", name, minJWTSecretLength))
+		}
+	}
+
+	if config.Algorithm == jwt.SigningMethodHS256.Alg() {
+		checkSecret("JWT_ACCESS_SECRET", config.AccessSecret)
+	} else if config.PrivateKeyPath == "" {
+		errs = append(errs, fmt.Errorf("JWT_PRIVATE_KEY_PATH must be set for %s", config.Algorithm))
+	}
+	checkSecret("JWT_REFRESH_SECRET", config.RefreshSecret)
+
+	if config.Algorithm == jwt.SigningMethodHS256.Alg() && len(config.AccessSecret) > 0 &&
+		string(config.AccessSecret) == string(config.RefreshSecret) {
+		errs = append(errs, fmt.Errorf("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET must differ"))
+	}
+
+	if config.AccessTTL <= 0 || config.AccessTTL > 24*time.Hour {
+		errs = append(errs, fmt.Errorf("JWT_ACCESS_TTL_MINUTES must be between 1 and 1440"))
+	}
+	if config.RefreshTTL <= 0 || config.RefreshTTL > 365*24*time.Hour {
+		errs = append(errs, fmt.Errorf("JWT_REFRESH_TTL_DAYS must be between 1 and 365"))
+	}
+	if config.RefreshTTL > 0 && config.RefreshTTL <= config.AccessTTL {
+		errs = append(errs, fmt.Errorf("refresh token TTL must be longer than access token TTL"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// InitJWT builds the token signers, it runs once from config.InitConfig
+// after JWTConfig.Validate
+func InitJWT(config JWTConfig) error {
+	options := JWTSignerOptions{
+		Algorithm: config.Algorithm,
+		KeyID:     config.KeyID,
+		Issuer:    config.Issuer,
+		Audience:  config.Audience,
+	}
+
+	if config.Algorithm == jwt.SigningMethodHS256.Alg() {
+		options.Secret = config.AccessSecret
+	} else {
+		privateKeyPEM, err := os.ReadFile(config.PrivateKeyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT_PRIVATE_KEY_PATH: %w", err)
+		}
+		options.PrivateKeyPEM = privateKeyPEM
+	}
+
+	verifyKeys, err := readVerifyKeys(config.VerifyKeyPaths)
+	if err != nil {
+		return err
+	}
+	options.VerifyKeys = verifyKeys
+
+	access, err := NewJWTSigner(options)
+	if err != nil {
+		return fmt.Errorf("failed to initialize access token signer: %w", err)
+	}
+
+	refresh, err := NewJWTSigner(JWTSignerOptions{
+		Secret:   config.RefreshSecret,
+		Issuer:   config.Issuer,
+		Audience: config.Audience,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize refresh token signer: %w", err)
+	}
+
+	jwtMu.Lock()
+	defer jwtMu.Unlock()
+
+	jwtConfig = config
+	accessSigner = access
+	refreshSigner = refresh
+
+	log.Printf("JWT signer initialized with %s", config.Algorithm)
+	return nil
 }
 
+func getJWTSigners() (*JWTSigner, *JWTSigner, error) {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+
+	if accessSigner == nil || refreshSigner == nil {
+		return nil, nil, fmt.Errorf("JWT is not initialized, call utils.InitJWT first")
+	}
+	return accessSigner, refreshSigner, nil
+}
+
+// FamilyID identifies the login session: every refresh token rotated from the
+// same login shares it, and access tokens carry it to tell sessions apart.
+// The refresh token jti is RegisteredClaims.ID.
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role,omitempty"`
+	UserID   string `json:"user_id"`
+	Role     string `json:"role,omitempty"`
+	FamilyID string `json:"fid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID, role string) (string, error) {
+func GenerateAccessToken(userID, role, familyID string) (string, error) {
+	signer, _, err := getJWTSigners()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:   userID,
+		Role:     role,
+		FamilyID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * time.Duration(accessTokenTTL))),
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtAccessSecret)
+	return signer.Sign(claims)
 }
 
-func GenerateRefreshToken(userID string) (string, error) {
+func GenerateRefreshToken(userID, tokenID, familyID string) (string, error) {
+	_, signer, err := getJWTSigners()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID: userID,
+		UserID:   userID,
+		FamilyID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * time.Duration(refreshTokenTTL))),
+			ID:        tokenID,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtRefreshSecret)
+	return signer.Sign(claims)
 }
 
-func ValidateAccessToken(tokenStr string) (*Claims, error) {
-	return validateToken(tokenStr, jwtAccessSecret)
+func AccessTokenTTL() time.Duration {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+
+	return jwtConfig.AccessTTL
 }
 
-func ValidateRefreshToken(tokenStr string) (*Claims, error) {
-	return validateToken(tokenStr, jwtRefreshSecret)
+func RefreshTokenTTL() time.Duration {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+
+	return jwtConfig.RefreshTTL
 }
 
-func validateToken(tokenStr string, secret []byte) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+func ValidateAccessToken(tokenStr string) (*Claims, error) {
+	signer, _, err := getJWTSigners()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Parse(tokenStr)
+}
 
-	if err != nil || !token.Valid {
+func ValidateRefreshToken(tokenStr string) (*Claims, error) {
+	_, signer, err := getJWTSigners()
+	if err != nil {
 		return nil, err
 	}
+	return signer.Parse(tokenStr)
+}
+
+// JWKSHandler serves the access token verification keys,
+// mounted at GET /.well-known/jwks.json
+func JWKSHandler(write http.ResponseWriter, request *http.Request) {
+	signer, _, err := getJWTSigners()
+	if err != nil {
+		log.Printf("failed to get JWT signer: %v", err)
+		Error(write, http.StatusInternalServerError, "Internal server error", nil)
+		return
+	}
 
-	return claims, nil
+	// JWKS clients expect the bare key set, not the response envelope
+	write.Header().Set("Content-Type", "application/json")
+	write.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(write).Encode(signer.JWKS())
 }
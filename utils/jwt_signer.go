@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTSigner signs and verifies tokens with one active key and any number of
+// extra verification keys, which keeps tokens of the previous key valid
+// during a rotation window.
+type JWTSigner struct {
+	method     jwt.SigningMethod
+	keyID      string
+	signingKey any
+	verifyKeys map[string]verificationKey
+	issuer     string
+	audience   []string
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    any
+}
+
+type JWTSignerOptions struct {
+	// Algorithm is one of HS256, RS256 or EdDSA
+	Algorithm string
+	// Secret is the HS256 shared secret
+	Secret []byte
+	// PrivateKeyPEM is the RS256 or EdDSA signing key
+	PrivateKeyPEM []byte
+	// KeyID defaults to the RFC 7638 thumbprint of the public key
+	KeyID string
+	// VerifyKeys are public keys of previous signing keys
+	VerifyKeys []JWTVerifyKey
+	Issuer     string
+	Audience   []string
+}
+
+type JWTVerifyKey struct {
+	// KeyID defaults to the RFC 7638 thumbprint of the key
+	KeyID     string
+	PublicPEM []byte
+}
+
+func NewJWTSigner(options JWTSignerOptions) (*JWTSigner, error) {
+	signer := &JWTSigner{
+		verifyKeys: make(map[string]verificationKey),
+		issuer:     options.Issuer,
+		audience:   options.Audience,
+	}
+
+	switch options.Algorithm {
+	case "", jwt.SigningMethodHS256.Alg():
+		if len(options.Secret) == 0 {
+			return nil, fmt.Errorf("HS256 requires a secret")
+		}
+		signer.method = jwt.SigningMethodHS256
+		signer.signingKey = options.Secret
+		signer.keyID = options.KeyID
+		signer.verifyKeys[signer.keyID] = verificationKey{method: signer.method, key: options.Secret}
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		privateKey, err := parsePrivateKeyPEM(options.PrivateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+
+		method, publicKey, err := publicKeyFor(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		if method.Alg() != options.Algorithm {
+			return nil, fmt.Errorf("private key does not match algorithm %s", options.Algorithm)
+		}
+
+		signer.method = method
+		signer.signingKey = privateKey
+		signer.keyID = options.KeyID
+		if signer.keyID == "" {
+			signer.keyID = keyThumbprint(publicKey)
+		}
+		signer.verifyKeys[signer.keyID] = verificationKey{method: method, key: publicKey}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q, use HS256, RS256 or EdDSA", options.Algorithm)
+	}
+
+	for i, verifyKey := range options.VerifyKeys {
+		publicKey, err := parsePublicKeyPEM(verifyKey.PublicPEM)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %d: %w", i+1, err)
+		}
+
+		method, err := methodFor(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %d: %w", i+1, err)
+		}
+		keyID := verifyKey.KeyID
+		if keyID == "" {
+			keyID = keyThumbprint(publicKey)
+		}
+		signer.verifyKeys[keyID] = verificationKey{method: method, key: publicKey}
+	}
+
+	return signer, nil
+}
+
+// Sign sets iss and aud from the signer options and adds the kid header
+func (signer *JWTSigner) Sign(claims *Claims) (string, error) {
+	if signer.issuer != "" {
+		claims.Issuer = signer.issuer
+	}
+	if len(signer.audience) > 0 {
+		claims.Audience = signer.audience
+	}
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	if signer.keyID != "" {
+		token.Header["kid"] = signer.keyID
+	}
+	return token.SignedString(signer.signingKey)
+}
+
+// Parse picks the verification key by kid and checks iss and aud when configured
+func (signer *JWTSigner) Parse(tokenStr string) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if signer.issuer != "" {
+		options = append(options, jwt.WithIssuer(signer.issuer))
+	}
+	if len(signer.audience) > 0 {
+		options = append(options, jwt.WithAudience(signer.audience...))
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, signer.keyFunc, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+func (signer *JWTSigner) keyFunc(token *jwt.Token) (any, error) {
+	keyID, _ := token.Header["kid"].(string)
+
+	key, ok := signer.verifyKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", keyID)
+	}
+
+	// never let the token header choose the algorithm for a key
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// JWK is a public key in RFC 7517 format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys, HS256 secrets are never published
+func (signer *JWTSigner) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for keyID, key := range signer.verifyKeys {
+		if jwk, ok := toJWK(keyID, key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
+
+func toJWK(keyID string, key verificationKey) (JWK, bool) {
+	switch publicKey := key.key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+			N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(bigEndianInt(publicKey.E)),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(publicKey),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// keyThumbprint is the RFC 7638 JWK thumbprint, a stable key ID
+func keyThumbprint(publicKey crypto.PublicKey) string {
+	var members any
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		// members in lexicographic order as required by RFC 7638
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{
+			E:   base64.RawURLEncoding.EncodeToString(bigEndianInt(key.E)),
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		}
+	case ed25519.PublicKey:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{
+			Crv: "Ed25519",
+			Kty: "OKP",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	default:
+		return ""
+	}
+
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func bigEndianInt(value int) []byte {
+	var result []byte
+	for value > 0 {
+		result = append([]byte{byte(value & 0xff)}, result...)
+		value >>= 8
+	}
+	return result
+}
+
+func parsePrivateKeyPEM(keyPEM []byte) (crypto.Signer, error) {
+	if len(keyPEM) == 0 {
+		return nil, fmt.Errorf("private key PEM is empty")
+	}
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM); err == nil {
+		return key, nil
+	}
+	key, err := jwt.ParseEdPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("private key is neither RSA nor Ed25519 PEM: %w", err)
+	}
+	return key.(crypto.Signer), nil
+}
+
+func parsePublicKeyPEM(keyPEM []byte) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(keyPEM); err == nil {
+		return key, nil
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("public key is neither RSA nor Ed25519 PEM: %w", err)
+	}
+	return key, nil
+}
+
+func publicKeyFor(privateKey crypto.Signer) (jwt.SigningMethod, crypto.PublicKey, error) {
+	publicKey := privateKey.Public()
+	method, err := methodFor(publicKey)
+	return method, publicKey, err
+}
+
+func methodFor(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// readVerifyKeys reads "kid=path" or "path" entries
+func readVerifyKeys(entries []string) ([]JWTVerifyKey, error) {
+	var keys []JWTVerifyKey
+	for _, entry := range entries {
+		keyID, path, found := strings.Cut(entry, "=")
+		if !found {
+			keyID, path = "", entry
+		}
+
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verification key: %w", err)
+		}
+		keys = append(keys, JWTVerifyKey{KeyID: keyID, PublicPEM: keyPEM})
+	}
+	return keys, nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxAcceptLanguages limits how many entries of an Accept-Language header are kept
+const maxAcceptLanguages = 10
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header
+// ordered by q, dropping "*" and q=0.
+//
+// Example:
+//
+//	ParseAcceptLanguage("en;q=0.8, id-ID, id;q=0.9") // [id-ID id en]
+func ParseAcceptLanguage(header string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		languages = append(languages, language{tag: tag, quality: quality})
+		if len(languages) == maxAcceptLanguages {
+			break
+		}
+	}
+
+	// stable keeps the header order between equal weights
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, len(languages))
+	for i, language := range languages {
+		tags[i] = language.tag
+	}
+	return tags
+}
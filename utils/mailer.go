@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mail is a complete RFC 5322 message with its SMTP envelope. Recipients
+// holds every To, Cc and Bcc address, Bcc never appears in Data.
+type Mail struct {
+	From       string
+	Recipients []string
+	Data       []byte
+}
+
+// Mailer delivers mail, InitEmail picks the implementation from MAIL_TRANSPORT
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// MemoryMailer records mail instead of sending it, for tests.
+//
+// Example:
+//
+//	mailer := utils.NewMemoryMailer()
+//	emailTemplates, err := utils.LoadEmailTemplates(templates.Email(""), "en")
+//	utils.InitEmail(utils.EmailConfig{FromEmail: "noreply@example.com"}, mailer, emailTemplates)
+//	// ... register a user
+//	sent := mailer.Messages()
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Mail
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mailer *MemoryMailer) Send(_ context.Context, mail Mail) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	mail.Recipients = slices.Clone(mail.Recipients)
+	mail.Data = bytes.Clone(mail.Data)
+	mailer.messages = append(mailer.messages, mail)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far
+func (mailer *MemoryMailer) Messages() []Mail {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	return slices.Clone(mailer.messages)
+}
+
+func (mailer *MemoryMailer) Reset() {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	mailer.messages = nil
+}
+
+// LogMailer writes mail to the log instead of sending it, for development
+// where links such as the verification URL are copied from the output
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (mailer *LogMailer) Send(_ context.Context, mail Mail) error {
+	subject := ""
+	body := string(mail.Data)
+	if message, err := parseMail(mail.Data); err == nil {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); err == nil {
+			subject = decoded
+		}
+		if text, err := readableBody(textproto.MIMEHeader(message.Header), message.Body); err == nil {
+			body = text
+		}
+	}
+
+	log.Printf("Mail not sent (MAIL_TRANSPORT=log): from=%s to=%s subject=%q\n%s",
+		mail.From, strings.Join(mail.Recipients, ", "), subject, body)
+	return nil
+}
+
+// FileMailer writes every mail as an .eml file into Dir, which mail clients
+// open directly
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (mailer *FileMailer) Send(_ context.Context, mail Mail) error {
+	// sortable by time, the random suffix keeps concurrent sends apart
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), GenerateRandomString(6))
+	path := filepath.Join(mailer.dir, name)
+
+	// the mail holds one time tokens, keep it private
+	if err := os.WriteFile(path, mail.Data, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
+
+func parseMail(data []byte) (*mail.Message, error) {
+	return mail.ReadMessage(bytes.NewReader(data))
+}
+
+// readableBody returns the decoded text/plain part, or the HTML one when the
+// mail has no plain text, so links are copied from the log as they are
+func readableBody(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		html := ""
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if part.Header.Get("Content-Disposition") != "" {
+				continue
+			}
+			text, err := readableBody(part.Header, part)
+			if err != nil {
+				continue
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "text/plain" || strings.HasPrefix(partType, "multipart/") {
+				return text, nil
+			}
+			if html == "" {
+				html = text
+			}
+		}
+		if html == "" {
+			return "", fmt.Errorf("mail has no text part")
+		}
+		return html, nil
+	}
+
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	return string(content), err
+}
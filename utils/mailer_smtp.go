@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+const defaultSMTPTimeout = 10 * time.Second
+
+const (
+	// SMTPSecurityStartTLS upgrades a plain connection, usually port 587
+	SMTPSecurityStartTLS = "starttls"
+	// SMTPSecurityTLS connects over TLS from the start, usually port 465
+	SMTPSecurityTLS = "tls"
+	// SMTPSecurityNone is for local catchers such as MailHog, never production
+	SMTPSecurityNone = "none"
+)
+
+type SMTPMailerConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Security string
+	// Timeout bounds dialing and every send
+	Timeout time.Duration
+	// IdleTimeout closes the reused connection after it sat unused this long
+	IdleTimeout time.Duration
+}
+
+// SMTPMailer keeps one authenticated connection open between sends, so
+// bursts of mail do not pay the TLS and AUTH handshake every time. Sends
+// are serialized over that connection.
+type SMTPMailer struct {
+	config SMTPMailerConfig
+
+	mu        sync.Mutex
+	client    *smtp.Client
+	conn      net.Conn
+	idleTimer *time.Timer
+}
+
+func NewSMTPMailer(config SMTPMailerConfig) (*SMTPMailer, error) {
+	switch config.Security {
+	case SMTPSecurityStartTLS, SMTPSecurityTLS, SMTPSecurityNone:
+	default:
+		return nil, fmt.Errorf("unsupported SMTP security %q, use starttls, tls or none", config.Security)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSMTPTimeout
+	}
+	return &SMTPMailer{config: config}, nil
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	// the server may have dropped the idle connection, RSET tells
+	if mailer.client != nil {
+		if err := mailer.withDeadline(ctx, mailer.client.Reset); err != nil {
+			mailer.closeLocked()
+		}
+	}
+	if mailer.client == nil {
+		if err := mailer.dial(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := mailer.withDeadline(ctx, func() error {
+		return mailer.transfer(mail)
+	})
+	if err != nil {
+		// the session state is unknown after a failure, start over next time
+		mailer.closeLocked()
+		return err
+	}
+
+	mailer.scheduleIdleClose()
+	return nil
+}
+
+// Close ends the reused connection, called on shutdown
+func (mailer *SMTPMailer) Close() error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	if mailer.client != nil {
+		_ = mailer.withDeadline(context.Background(), mailer.client.Quit)
+	}
+	mailer.closeLocked()
+	return nil
+}
+
+func (mailer *SMTPMailer) dial(ctx context.Context) error {
+	address := net.JoinHostPort(mailer.config.Host, mailer.config.Port)
+	tlsConfig := &tls.Config{ServerName: mailer.config.Host, MinVersion: tls.VersionTLS12}
+
+	ctx, cancel := context.WithTimeout(ctx, mailer.config.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if mailer.config.Security == SMTPSecurityTLS {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, mailer.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if mailer.config.Security == SMTPSecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if mailer.config.Username != "" {
+		auth := smtp.PlainAuth("", mailer.config.Username, mailer.config.Password, mailer.config.Host)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return fmt.Errorf("failed to authenticate to SMTP server: %w", err)
+		}
+	}
+
+	mailer.client = client
+	mailer.conn = conn
+	return nil
+}
+
+func (mailer *SMTPMailer) transfer(mail Mail) error {
+	if err := mailer.client.Mail(mail.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range mail.Recipients {
+		if err := mailer.client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	writer, err := mailer.client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(mail.Data); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected mail: %w", err)
+	}
+	return nil
+}
+
+// withDeadline applies the send timeout, or the ctx deadline when earlier
+func (mailer *SMTPMailer) withDeadline(ctx context.Context, fn func() error) error {
+	deadline := time.Now().Add(mailer.config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := mailer.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (mailer *SMTPMailer) scheduleIdleClose() {
+	if mailer.config.IdleTimeout <= 0 {
+		return
+	}
+	if mailer.idleTimer != nil {
+		mailer.idleTimer.Stop()
+	}
+
+	client := mailer.client
+	mailer.idleTimer = time.AfterFunc(mailer.config.IdleTimeout, func() {
+		mailer.mu.Lock()
+		defer mailer.mu.Unlock()
+
+		// a newer connection replaced the one this timer was set for
+		if mailer.client != client {
+			return
+		}
+		_ = mailer.withDeadline(context.Background(), mailer.client.Quit)
+		mailer.closeLocked()
+	})
+}
+
+func (mailer *SMTPMailer) closeLocked() {
+	if mailer.idleTimer != nil {
+		mailer.idleTimer.Stop()
+		mailer.idleTimer = nil
+	}
+	if mailer.client != nil {
+		_ = mailer.client.Close()
+	}
+	mailer.client = nil
+	mailer.conn = nil
+}
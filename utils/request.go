@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const maxRequestBodyBytes = 1 << 20
+
+// DecodeJSON reads a JSON request body into destination, limited to 1MB.
+// Usage example:
+//
+//	var payload CreateRequest
+//	if err := utils.DecodeJSON(write, request, &payload); err != nil {
+//		utils.Error(write, http.StatusBadRequest, "Invalid request body", []string{err.Error()})
+//		return
+//	}
+func DecodeJSON(write http.ResponseWriter, request *http.Request, destination any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(write, request.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(destination); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("request body is empty")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type Middleware func(http.Handler) http.Handler
+
+// Router wraps http.ServeMux with route groups and middleware.
+// Routes use the Go 1.22+ pattern syntax, e.g. "GET /users/{id}".
+type Router struct {
+	mux         *http.ServeMux
+	middlewares []Middleware
+	RouteGroup
+}
+
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+}
+
+type routeInfoKey struct{}
+
+type routeInfo struct {
+	pattern string
+}
+
+func NewRouter() *Router {
+	router := &Router{mux: http.NewServeMux()}
+	router.RouteGroup = RouteGroup{router: router}
+	return router
+}
+
+// Use adds middleware that runs for every request, including unmatched routes.
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+func (router *Router) ServeHTTP(write http.ResponseWriter, request *http.Request) {
+	ctx := context.WithValue(request.Context(), routeInfoKey{}, &routeInfo{})
+	var handler http.Handler = router.mux
+	for i := len(router.middlewares) - 1; i >= 0; i-- {
+		handler = router.middlewares[i](handler)
+	}
+	handler.ServeHTTP(write, request.WithContext(ctx))
+}
+
+// Group creates a sub group, e.g. api.Group("/users") under "/api/v1".
+// Middlewares only apply to routes registered on the group.
+func (group *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix = "/" + prefix
+	}
+
+	return &RouteGroup{
+		router:      group.router,
+		prefix:      group.prefix + prefix,
+		middlewares: append(append([]Middleware{}, group.middlewares...), middlewares...),
+	}
+}
+
+// Use adds middleware to routes registered on the group afterwards.
+func (group *RouteGroup) Use(middlewares ...Middleware) {
+	group.middlewares = append(group.middlewares, middlewares...)
+}
+
+// Example: group.Handle(http.MethodGet, "/{id}", controller.GetByID)
+func (group *RouteGroup) Handle(method, path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	var wrapped http.Handler = handler
+	all := append(append([]Middleware{}, group.middlewares...), middlewares...)
+	for i := len(all) - 1; i >= 0; i-- {
+		wrapped = all[i](wrapped)
+	}
+
+	pattern := group.prefix + path
+	if pattern == "" {
+		pattern = "/"
+	}
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+
+	group.router.mux.Handle(pattern, recordPattern(wrapped))
+}
+
+func (group *RouteGroup) GET(path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.Handle(http.MethodGet, path, handler, middlewares...)
+}
+
+func (group *RouteGroup) POST(path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.Handle(http.MethodPost, path, handler, middlewares...)
+}
+
+func (group *RouteGroup) PUT(path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.Handle(http.MethodPut, path, handler, middlewares...)
+}
+
+func (group *RouteGroup) PATCH(path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.Handle(http.MethodPatch, path, handler, middlewares...)
+}
+
+func (group *RouteGroup) DELETE(path string, handler http.HandlerFunc, middlewares ...Middleware) {
+	group.Handle(http.MethodDelete, path, handler, middlewares...)
+}
+
+// recordPattern stores the matched pattern so middleware registered with
+// Router.Use can read it after the mux has dispatched the request.
+func recordPattern(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, request *http.Request) {
+		if info, ok := request.Context().Value(routeInfoKey{}).(*routeInfo); ok {
+			info.pattern = request.Pattern
+		}
+		next.ServeHTTP(write, request)
+	})
+}
+
+// RoutePattern returns the matched route pattern, e.g. "GET /api/v1/users/{id}".
+// It is empty when no route matched.
+func RoutePattern(request *http.Request) string {
+	if request.Pattern != "" {
+		return request.Pattern
+	}
+	if info, ok := request.Context().Value(routeInfoKey{}).(*routeInfo); ok {
+		return info.pattern
+	}
+	return ""
+}
+
+// Example: PathParam(request, "id") for route "GET /users/{id}"
+func PathParam(request *http.Request, name string) string {
+	return request.PathValue(name)
+}
@@ -14,47 +14,46 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
 var (
-	s3Client     *minio.Client
-	s3ClientOnce sync.Once
-	s3InitErr    error
+	s3Client   *minio.Client
+	s3Config   S3Config
+	s3ClientMu sync.RWMutex
 )
 
-func getS3Client() (*minio.Client, error) {
-	s3ClientOnce.Do(func() {
-		endpoint := GetEnv("S3_ENDPOINT", "")
-		accessKey := GetEnv("S3_ACCESS_KEY", "")
-		secretKey := GetEnv("S3_SECRET_KEY", "")
-		useSSL := GetEnv("S3_SSL", "false")
-
-		if endpoint == "" || accessKey == "" || secretKey == "" {
-			s3InitErr = fmt.Errorf("S3_ENDPOINT, S3_ACCESS_KEY, and S3_SECRET_KEY must be set in environment variables")
-			return
-		}
+// InitS3 creates the client, called from config.InitConfig when S3_ENDPOINT is set
+func InitS3(config S3Config) error {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize S3 client: %w", err)
+	}
 
-		ssl := false
-		if useSSL == "true" {
-			ssl = true
-		}
+	s3ClientMu.Lock()
+	defer s3ClientMu.Unlock()
 
-		client, err := minio.New(endpoint, &minio.Options{
-			Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-			Secure: ssl,
-		})
+	s3Client = client
+	s3Config = config
 
-		if err != nil {
-			s3InitErr = fmt.Errorf("failed to initialize S3 client: %w", err)
-			return
-		}
+	log.Println("S3 client initialized successfully")
+	return nil
+}
 
-		s3Client = client
-		log.Println("S3 client initialized successfully")
-	})
+func getS3Client() (*minio.Client, error) {
+	s3ClientMu.RLock()
+	defer s3ClientMu.RUnlock()
 
-	if s3InitErr != nil {
-		return nil, s3InitErr
+	if s3Client == nil {
+		return nil, fmt.Errorf("S3 is not initialized, set S3_ENDPOINT, S3_ACCESS_KEY, and S3_SECRET_KEY")
 	}
-
 	return s3Client, nil
 }
 
@@ -145,16 +144,17 @@ func DeleteFile(bucketName, prefix, fileName string) error {
 // Example: DownloadPublicFile("bucket", "uploads/images", "photo.jpg")
 // prefix is optional, use "" for root level
 func DownloadPublicFile(bucketName, prefix, fileName string) string {
-	endpoint := GetEnv("S3_ENDPOINT", "")
-	useSSL := GetEnv("S3_SSL", "false")
+	s3ClientMu.RLock()
+	config := s3Config
+	s3ClientMu.RUnlock()
 
 	protocol := "http"
-	if useSSL == "true" {
+	if config.UseSSL {
 		protocol = "https"
 	}
 
 	objectPath := buildPath(prefix, fileName)
-	return fmt.Sprintf("%s://%s/%s/%s", protocol, endpoint, bucketName, objectPath)
+	return fmt.Sprintf("%s://%s/%s/%s", protocol, config.Endpoint, bucketName, objectPath)
 }
 
 // Example: DownloadPrivateFile("bucket", "private/docs", "document.pdf", time.Hour)
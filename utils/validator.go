@@ -2,12 +2,31 @@ package utils
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New()
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	if err := validate.RegisterValidation("maxbytes", maxBytes); err != nil {
+		panic(err)
+	}
+	return validate
+}
+
+// maxBytes limits the UTF-8 length of a string, max counts characters, e.g.
+// bcrypt only takes 72 bytes: maxbytes=72
+func maxBytes(field validator.FieldLevel) bool {
+	limit, err := strconv.Atoi(field.Param())
+	if err != nil {
+		return false
+	}
+	return len(field.Field().String()) <= limit
+}
 
 func ValidateStruct(structure any) []string {
 	err := validate.Struct(structure)
@@ -43,6 +62,8 @@ func buildErrorMessage(field, tag, param string) string {
 		return fmt.Sprintf("%s must be at least %s characters", field, param)
 	case "max":
 		return fmt.Sprintf("%s must be at most %s characters", field, param)
+	case "maxbytes":
+		return fmt.Sprintf("%s must be at most %s bytes, non-ASCII characters take up to 4", field, param)
 	default:
 		return fmt.Sprintf("%s is not valid", field)
 	}